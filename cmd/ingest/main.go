@@ -0,0 +1,176 @@
+// ingest загружает изображения из папки в базу: показывает diff с текущим каталогом и применяет его.
+//
+//	go run ./cmd/ingest --root ./static/images --dry-run
+//	go run ./cmd/ingest --prune --verbose --continue-on-error
+//
+// С --lint только проверяет имена файлов; --fix переименовывает нарушителей:
+//
+//	go run ./cmd/ingest --lint --format json
+//	go run ./cmd/ingest --lint --fix
+package main
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/scripts"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	root := flag.String("root", "./static/images", "папка с изображениями {family}/{group}/{subgroup}/{image}")
+	dryRun := flag.Bool("dry-run", false, "только показать изменения, ничего не меняя")
+	prune := flag.Bool("prune", false, "удалить из базы изображения и таксономию, которых нет на диске")
+	verbose := flag.Bool("verbose", false, "выводить каждый обрабатываемый файл")
+	continueOnError := flag.Bool("continue-on-error", false, "пропускать файлы с ошибками вместо отмены всей загрузки")
+	workers := flag.Int("workers", runtime.NumCPU(), "сколько миниатюр создавать параллельно")
+	renditionSpec := flag.String("renditions", "", "миниатюры вида small=128,medium=256,square=128:crop (по умолчанию THUMBNAIL_RENDITIONS или small=128,medium=256,large=512)")
+	lint := flag.Bool("lint", false, "проверить имена файлов (Family_Group_Subgroup_NN, номера, миниатюры, расширения) без загрузки")
+	fix := flag.Bool("fix", false, "вместе с -lint: переименовать файлы с нарушениями и удалить лишние миниатюры")
+	format := flag.String("format", "text", "формат вывода -lint: text или json")
+	server := flag.String("server", "", "адрес работающего сервера, которому после изменений нужно перестроить индексы (по умолчанию BASE_URL)")
+	flag.Parse()
+
+	if *lint {
+		runLint(*root, *fix, *format, *server)
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	// Флаг переопределяет THUMBNAIL_RENDITIONS; без них — те же миниатюры, что и у загрузки через админку
+	spec := *renditionSpec
+	if spec == "" {
+		spec = cfg.ThumbnailRenditions
+	}
+	renditions, err := scripts.ParseRenditions(spec)
+	if err != nil {
+		log.Fatalf("Invalid renditions %q: %v", spec, err)
+	}
+	db, err := config.NewConnection(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Ctrl-C останавливает загрузку: начатые миниатюры не сохраняются, транзакция откатывается
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	opts := scripts.IngestOptions{
+		DryRun:          *dryRun,
+		Prune:           *prune,
+		Verbose:         *verbose,
+		ContinueOnError: *continueOnError,
+		Workers:         *workers,
+		Renditions:      renditions,
+		// diff выводится до создания миниатюр и записи в базу, которые могут занять минуты
+		OnDiff: func(diff *scripts.CatalogDiff) {
+			diff.Print(os.Stdout)
+		},
+		Progress: func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rThumbnails: %d/%d", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		},
+	}
+	report, err := scripts.Ingest(ctx, db, *root, opts)
+	report.PrintSummary(os.Stdout)
+	if err != nil {
+		log.Fatalf("Ingest failed: %v", err)
+	}
+	if report.Applied {
+		rebuildServerIndexes(cfg, *server)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runLint проверяет имена файлов в root. База нужна только для исправления: вместе с файлами
+// переименовываются записи изображений. Завершается с кодом 1, если остались нарушения.
+func runLint(root string, fix bool, format, server string) {
+	if format != "text" && format != "json" {
+		log.Fatalf("Invalid -format %q: expected text or json", format)
+	}
+
+	var cfg *config.Config
+	var db *sql.DB
+	if fix {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if db, err = config.NewConnection(cfg); err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+	}
+
+	report, err := scripts.Lint(context.Background(), db, root, fix)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			log.Fatalf("Failed to write report: %v", encErr)
+		}
+	} else {
+		report.Print(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Lint failed: %v", err)
+	}
+	if report.Fixed > 0 {
+		rebuildServerIndexes(cfg, server)
+	}
+	if report.Unfixed() > 0 {
+		os.Exit(1)
+	}
+}
+
+// rebuildServerIndexes просит работающий сервер перестроить индексы автодополнения и похожих
+// изображений, чтобы изменения каталога появились сразу. Без адреса или ADMIN_TOKEN ничего не делает;
+// недоступный сервер не считается ошибкой загрузки — он перестроит индексы по расписанию.
+func rebuildServerIndexes(cfg *config.Config, server string) {
+	if server == "" {
+		server = cfg.BaseURL
+	}
+	if server == "" || cfg.AdminToken == "" {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+"/admin/indexes/rebuild", nil)
+	if err != nil {
+		log.Printf("Failed to rebuild server indexes: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.AdminToken)
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Failed to rebuild server indexes: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		log.Printf("Failed to rebuild server indexes: %s", resp.Status)
+		return
+	}
+	log.Printf("Server indexes rebuilt")
+}
@@ -4,9 +4,15 @@ import (
 	"HorizonBackend/config"
 	"HorizonBackend/internal/router"
 	"HorizonBackend/scripts"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -14,8 +20,8 @@ import (
 func setCORSHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-License-UUID")
 		if r.Method == "OPTIONS" {
 			return
 		}
@@ -23,11 +29,18 @@ func setCORSHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// Сколько ждём завершения текущих запросов при остановке сервера
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
 		panic(err)
 	}
+	renditions, err := scripts.ParseRenditions(cfg.ThumbnailRenditions)
+	if err != nil {
+		panic(fmt.Errorf("invalid THUMBNAIL_RENDITIONS: %w", err))
+	}
 
 	db, err := config.NewConnection(cfg)
 	if err != nil {
@@ -39,14 +52,40 @@ func main() {
 		}
 	}()
 
-	// Этот скрипт добавляет изображения из папки в базу данных
-	scripts.AddImagesFromFolder(db, "./static/images")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Обычно каталог обновляется командой cmd/ingest; при старте — только если это явно включено
+	// Ошибка загрузки не мешает запуску: каталог остаётся в прежнем состоянии
+	if cfg.IngestOnStart {
+		report, err := scripts.Ingest(ctx, db, "./static/images", scripts.IngestOptions{Prune: true, ContinueOnError: true, Renditions: renditions})
+		report.Print(os.Stdout)
+		if err != nil {
+			log.Printf("Failed to ingest images: %v", err)
+		}
+	}
+
+	r, shutdown := router.NewRouter(db, cfg, renditions)
+	// Вызывается до закрытия базы, чтобы записать накопленные использования
+	defer shutdown()
 
-	r := router.NewRouter(db, cfg)
+	srv := &http.Server{Addr: ":8000", Handler: setCORSHeaders(r)}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server gracefully: %v", err)
+		}
+	}()
 
 	fmt.Println("Server started on :8000")
-	err = http.ListenAndServe(":8000", setCORSHeaders(r))
-	if err != nil {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	// ListenAndServe возвращается сразу, а Shutdown ещё ждёт текущие запросы
+	<-stopped
+	fmt.Println("Server stopped")
 }
@@ -0,0 +1,114 @@
+// usage-report выгружает отчёт об использовании изображений за период в CSV или JSON.
+//
+//	go run ./cmd/usage-report -month 2026-09 -level subgroup -format csv -out usage.csv
+package main
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	level := flag.String("level", model.UsageReportSubgroup, "уровень агрегации: family, group, subgroup или image")
+	family := flag.String("family", "", "только указанное семейство")
+	month := flag.String("month", "", "календарный месяц YYYY-MM (по умолчанию — прошлый месяц)")
+	fromStr := flag.String("from", "", "начало периода YYYY-MM-DD (вместо -month)")
+	toStr := flag.String("to", "", "конец периода YYYY-MM-DD, не включается (вместо -month)")
+	format := flag.String("format", "csv", "формат: csv или json")
+	out := flag.String("out", "", "файл для отчёта (по умолчанию stdout)")
+	flag.Parse()
+
+	if !service.ValidUsageReportLevel(*level) {
+		log.Fatal(service.ErrInvalidReportLevel)
+	}
+	if *format != "csv" && *format != "json" {
+		log.Fatal("format must be csv or json")
+	}
+	from, to, err := reportPeriod(*month, *fromStr, *toStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := config.NewConnection(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	report, err := service.NewUsageReportService(postgres.NewUsageRepository(db)).GetUsageReport(*level, *family, from, to)
+	if err != nil {
+		log.Fatalf("Failed to build usage report: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = service.WriteUsageReportCSV(w, *level, report)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write usage report: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Usage report by %s from %s to %s: %d rows\n", *level, from.Format(dateLayout), to.Format(dateLayout), len(report))
+}
+
+// reportPeriod возвращает период [from, to): явные -from/-to, месяц -month или прошлый месяц
+func reportPeriod(month, fromStr, toStr string) (time.Time, time.Time, error) {
+	if fromStr != "" || toStr != "" {
+		if fromStr == "" || toStr == "" {
+			return time.Time{}, time.Time{}, fmt.Errorf("both -from and -to are required")
+		}
+		from, err := time.Parse(dateLayout, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -from, expected YYYY-MM-DD")
+		}
+		to, err := time.Parse(dateLayout, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to, expected YYYY-MM-DD")
+		}
+		if !from.Before(to) {
+			return time.Time{}, time.Time{}, fmt.Errorf("-from must be before -to")
+		}
+		return from, to, nil
+	}
+
+	if month == "" {
+		now := time.Now().UTC()
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.AddDate(0, -1, 0), start, nil
+	}
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -month, expected YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +18,38 @@ type Config struct {
 	PgSSLMode string
 	BaseURL   string
 	CheckURL  string
+	// Токен для /admin/* эндпоинтов; пустой токен отключает админку
+	AdminToken string
+	// Как часто буфер использований записывается в базу
+	UsageFlushInterval time.Duration
+	// Повторные использования одного изображения одним UUID в этом окне не засчитываются; 0 отключает
+	UsageDedupWindow time.Duration
+	// Сколько действует успешная проверка лицензии через /check
+	LicenseGrantTTL time.Duration
+	// Загружать изображения из ./static/images при старте сервера (обычно это делает cmd/ingest)
+	IngestOnStart bool
+	// Миниатюры разных размеров вида "small=128,medium=256,square=128:crop"; общие для загрузки
+	// через админку и cmd/ingest. Пустая строка — small=128,medium=256,large=512
+	ThumbnailRenditions string
+}
+
+const (
+	defaultUsageFlushInterval = 2 * time.Second
+	defaultUsageDedupWindow   = 10 * time.Minute
+	defaultLicenseGrantTTL    = 24 * time.Hour
+)
+
+// durationEnv читает длительность из переменной окружения (например, "10m"); пустое значение — def
+func durationEnv(name string, def time.Duration, allowZero bool) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return d, nil
 }
 
 func Load() (*Config, error) {
@@ -24,15 +58,36 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	usageFlushInterval, err := durationEnv("USAGE_FLUSH_INTERVAL", defaultUsageFlushInterval, false)
+	if err != nil {
+		return nil, err
+	}
+	usageDedupWindow, err := durationEnv("USAGE_DEDUP_WINDOW", defaultUsageDedupWindow, true)
+	if err != nil {
+		return nil, err
+	}
+	licenseGrantTTL, err := durationEnv("LICENSE_GRANT_TTL", defaultLicenseGrantTTL, false)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		Port:      os.Getenv("PORT"),
-		PgHost:    os.Getenv("PG_HOST"),
-		PgPort:    os.Getenv("PG_PORT"),
-		PgUser:    os.Getenv("PG_USER"),
-		PgPass:    os.Getenv("PG_PASS"),
-		PgDBName:  os.Getenv("PG_DBNAME"),
-		PgSSLMode: os.Getenv("PG_SSLMODE"),
-		BaseURL:   os.Getenv("BASE_URL"),
-		CheckURL:  os.Getenv("CHECK_URL"),
+		Port:       os.Getenv("PORT"),
+		PgHost:     os.Getenv("PG_HOST"),
+		PgPort:     os.Getenv("PG_PORT"),
+		PgUser:     os.Getenv("PG_USER"),
+		PgPass:     os.Getenv("PG_PASS"),
+		PgDBName:   os.Getenv("PG_DBNAME"),
+		PgSSLMode:  os.Getenv("PG_SSLMODE"),
+		BaseURL:    os.Getenv("BASE_URL"),
+		CheckURL:   os.Getenv("CHECK_URL"),
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+		UsageFlushInterval: usageFlushInterval,
+		UsageDedupWindow:   usageDedupWindow,
+		LicenseGrantTTL:    licenseGrantTTL,
+		IngestOnStart:      os.Getenv("INGEST_ON_START") == "true",
+
+		ThumbnailRenditions: os.Getenv("THUMBNAIL_RENDITIONS"),
 	}, nil
 }
@@ -0,0 +1,9 @@
+-- Какие изображения из подборки наименее используемых уже показывались пользователю
+CREATE TABLE suggestion_impressions (
+                                        license_uuid TEXT NOT NULL,
+                                        image_id     INTEGER NOT NULL REFERENCES Images(id) ON DELETE CASCADE,
+                                        shown_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                        PRIMARY KEY (license_uuid, image_id)
+);
+
+CREATE INDEX idx_suggestion_impressions_shown_at ON suggestion_impressions (shown_at);
@@ -0,0 +1,19 @@
+DROP TRIGGER IF EXISTS usage_events_count_deleted ON usage_events;
+DROP TRIGGER IF EXISTS usage_events_count_inserted ON usage_events;
+DROP FUNCTION IF EXISTS usage_events_count_deleted();
+DROP FUNCTION IF EXISTS usage_events_count_inserted();
+
+CREATE FUNCTION usage_events_sync_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE Images SET usage_count = usage_count + 1 WHERE id = NEW.image_id;
+        RETURN NEW;
+    END IF;
+    UPDATE Images SET usage_count = GREATEST(usage_count - 1, 0) WHERE id = OLD.image_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER usage_events_sync_count
+    AFTER INSERT OR DELETE ON usage_events
+    FOR EACH ROW EXECUTE FUNCTION usage_events_sync_count();
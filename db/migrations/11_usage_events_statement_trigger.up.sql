@@ -0,0 +1,32 @@
+-- Буферизованная запись вставляет много событий одним запросом: пересчитываем usage_count
+-- одним UPDATE на изображение за запрос вместо UPDATE на каждую строку
+DROP TRIGGER IF EXISTS usage_events_sync_count ON usage_events;
+DROP FUNCTION IF EXISTS usage_events_sync_count();
+
+CREATE FUNCTION usage_events_count_inserted() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE Images i SET usage_count = i.usage_count + n.cnt
+    FROM (SELECT image_id, COUNT(*) AS cnt FROM new_events GROUP BY image_id) n
+    WHERE i.id = n.image_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION usage_events_count_deleted() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE Images i SET usage_count = GREATEST(i.usage_count - o.cnt, 0)
+    FROM (SELECT image_id, COUNT(*) AS cnt FROM old_events GROUP BY image_id) o
+    WHERE i.id = o.image_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER usage_events_count_inserted
+    AFTER INSERT ON usage_events
+    REFERENCING NEW TABLE AS new_events
+    FOR EACH STATEMENT EXECUTE FUNCTION usage_events_count_inserted();
+
+CREATE TRIGGER usage_events_count_deleted
+    AFTER DELETE ON usage_events
+    REFERENCING OLD TABLE AS old_events
+    FOR EACH STATEMENT EXECUTE FUNCTION usage_events_count_deleted();
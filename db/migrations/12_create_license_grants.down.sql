@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_usage_events_license_image;
+DROP TABLE IF EXISTS license_grants;
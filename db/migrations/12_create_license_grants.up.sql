@@ -0,0 +1,9 @@
+-- UUID лицензий, успешно прошедших /check. Использования без действующей записи отклоняются.
+CREATE TABLE license_grants (
+                                license_uuid TEXT PRIMARY KEY,
+                                granted_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                expires_at   TIMESTAMPTZ NOT NULL
+);
+
+-- Проверка повторного использования изображения одним пользователем в окне дедупликации
+CREATE INDEX idx_usage_events_license_image ON usage_events (license_uuid, image_id, created_at);
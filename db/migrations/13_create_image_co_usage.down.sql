@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW IF EXISTS image_co_usage;
@@ -0,0 +1,41 @@
+-- Какие изображения используют вместе в одной сессии. Сессия — использования одной лицензии,
+-- между которыми проходит не больше 30 минут. Учитываются последние 90 дней; сессии больше
+-- 50 изображений (массовые вставки) пропускаются. Пара попадает в представление, если её
+-- использовали хотя бы две разные лицензии. score — косинусная мера: sessions / sqrt(n_a * n_b).
+-- Обновляется сервером через REFRESH MATERIALIZED VIEW CONCURRENTLY.
+CREATE MATERIALIZED VIEW image_co_usage AS
+WITH ordered AS (
+    SELECT license_uuid, image_id, created_at,
+           CASE WHEN created_at - LAG(created_at) OVER (PARTITION BY license_uuid ORDER BY created_at) <= INTERVAL '30 minutes'
+                THEN 0 ELSE 1 END AS new_session
+    FROM usage_events
+    WHERE license_uuid != '' AND created_at >= now() - INTERVAL '90 days'
+), numbered AS (
+    SELECT license_uuid, image_id,
+           SUM(new_session) OVER (PARTITION BY license_uuid ORDER BY created_at ROWS UNBOUNDED PRECEDING) AS session_no
+    FROM ordered
+), sessions AS (
+    SELECT DISTINCT license_uuid, session_no, image_id FROM numbered
+), sized AS (
+    SELECT *, COUNT(*) OVER (PARTITION BY license_uuid, session_no) AS session_size FROM sessions
+), filtered AS (
+    SELECT license_uuid, session_no, image_id FROM sized WHERE session_size BETWEEN 2 AND 50
+), totals AS (
+    SELECT image_id, COUNT(*) AS sessions FROM filtered GROUP BY image_id
+), pairs AS (
+    SELECT a.image_id, b.image_id AS other_id,
+           COUNT(*) AS sessions,
+           COUNT(DISTINCT a.license_uuid) AS licenses
+    FROM filtered a
+    JOIN filtered b ON a.license_uuid = b.license_uuid AND a.session_no = b.session_no AND a.image_id != b.image_id
+    GROUP BY a.image_id, b.image_id
+)
+SELECT p.image_id, p.other_id, p.sessions, p.licenses,
+       (p.sessions / sqrt(ta.sessions::float8 * tb.sessions))::float8 AS score
+FROM pairs p
+JOIN totals ta ON ta.image_id = p.image_id
+JOIN totals tb ON tb.image_id = p.other_id
+WHERE p.licenses >= 2;
+
+CREATE UNIQUE INDEX idx_image_co_usage_pair ON image_co_usage (image_id, other_id);
+CREATE INDEX idx_image_co_usage_score ON image_co_usage (image_id, score DESC);
@@ -0,0 +1,6 @@
+-- Когда лицензия очистила историю недавно использованных изображений. Сами события
+-- usage_events не удаляются, чтобы не менять usage_count и отчёты.
+CREATE TABLE usage_history_resets (
+                                      license_uuid TEXT PRIMARY KEY,
+                                      cleared_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
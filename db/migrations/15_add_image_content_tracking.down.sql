@@ -0,0 +1,9 @@
+ALTER TABLE Images
+    DROP COLUMN IF EXISTS source_hash,
+    DROP COLUMN IF EXISTS source_size,
+    DROP COLUMN IF EXISTS source_mtime,
+    DROP COLUMN IF EXISTS thumb_hash,
+    DROP COLUMN IF EXISTS thumb_size,
+    DROP COLUMN IF EXISTS thumb_mtime,
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,11 @@
+-- Состояние файлов изображения и миниатюры при последней загрузке: по ним загрузка находит
+-- заменённые файлы. version растёт при изменении содержимого файлов, updated_at — при любом изменении.
+ALTER TABLE Images
+    ADD COLUMN source_hash  TEXT,
+    ADD COLUMN source_size  BIGINT,
+    ADD COLUMN source_mtime TIMESTAMPTZ,
+    ADD COLUMN thumb_hash   TEXT,
+    ADD COLUMN thumb_size   BIGINT,
+    ADD COLUMN thumb_mtime  TIMESTAMPTZ,
+    ADD COLUMN version      INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at   TIMESTAMPTZ NOT NULL DEFAULT now();
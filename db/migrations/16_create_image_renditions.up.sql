@@ -0,0 +1,15 @@
+-- Миниатюры изображения разных размеров с сохранением пропорций (или квадратной обрезкой).
+-- max_size и crop — настройки, с которыми файл создан: при их изменении миниатюра создаётся заново.
+CREATE TABLE image_renditions (
+                                  image_id INTEGER NOT NULL REFERENCES Images(id) ON DELETE CASCADE,
+                                  name     TEXT NOT NULL,
+                                  path     TEXT NOT NULL,
+                                  max_size INTEGER NOT NULL,
+                                  crop     BOOLEAN NOT NULL DEFAULT false,
+                                  width    INTEGER NOT NULL,
+                                  height   INTEGER NOT NULL,
+                                  hash     TEXT NOT NULL,
+                                  size     BIGINT NOT NULL,
+                                  mtime    TIMESTAMPTZ NOT NULL,
+                                  PRIMARY KEY (image_id, name)
+);
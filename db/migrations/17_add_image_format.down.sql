@@ -0,0 +1,3 @@
+ALTER TABLE Images
+    DROP COLUMN IF EXISTS format,
+    DROP COLUMN IF EXISTS animated;
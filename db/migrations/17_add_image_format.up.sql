@@ -0,0 +1,4 @@
+-- Формат исходного файла (jpeg, png, gif, webp, tiff, bmp, svg) и признак анимации (GIF с несколькими кадрами)
+ALTER TABLE Images
+    ADD COLUMN format   TEXT,
+    ADD COLUMN animated BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- Возвращаем использования 'legacy' в usage_count до удаления: триггер удаления вычтет их обратно
+UPDATE Images i SET usage_count = i.usage_count + l.cnt
+FROM (SELECT image_id, COUNT(*) AS cnt FROM usage_events WHERE action = 'legacy' GROUP BY image_id) l
+WHERE i.id = l.image_id;
+
+DELETE FROM usage_events WHERE action = 'legacy';
@@ -0,0 +1,11 @@
+-- Использования, записанные до появления журнала, есть только в usage_count. Добавляем по одному событию
+-- 'legacy' на каждую единицу usage_count, которую не объясняют события журнала, чтобы usage_count
+-- оставался агрегатом usage_events, а отчёты за всё время сходились с ним. Время событий — начало эпохи:
+-- в окна популярности, всплесков и рекомендаций они не попадают, а лицензии у них нет.
+INSERT INTO usage_events (image_id, license_uuid, action, created_at)
+SELECT i.id, '', 'legacy', TIMESTAMPTZ '1970-01-01 00:00:00+00'
+FROM Images i
+CROSS JOIN LATERAL generate_series(1, COALESCE(i.usage_count, 0) - (SELECT COUNT(*) FROM usage_events e WHERE e.image_id = i.id));
+
+-- Триггер добавил события к usage_count ещё раз; пересчитываем по журналу
+UPDATE Images i SET usage_count = (SELECT COUNT(*) FROM usage_events e WHERE e.image_id = i.id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_images_meta_tags;
+ALTER TABLE Images
+    DROP COLUMN IF EXISTS title,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS author,
+    DROP COLUMN IF EXISTS license;
@@ -0,0 +1,8 @@
+-- Метаданные из sidecar-файлов (Name_01.json / Name_01.yaml / _meta.yaml)
+ALTER TABLE Images
+    ADD COLUMN title       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN author      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN license     TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_images_meta_tags ON Images USING GIN (meta_tags);
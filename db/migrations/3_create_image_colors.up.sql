@@ -0,0 +1,11 @@
+-- Доминирующая палитра изображения (для SVG — цвета заливки)
+CREATE TABLE image_colors (
+                              image_id INTEGER NOT NULL REFERENCES Images(id) ON DELETE CASCADE,
+                              position SMALLINT NOT NULL,
+                              hex      TEXT NOT NULL,
+                              l        REAL NOT NULL,
+                              a        REAL NOT NULL,
+                              b        REAL NOT NULL,
+                              weight   REAL NOT NULL,
+                              PRIMARY KEY (image_id, position)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE Images
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS aspect_ratio,
+    DROP COLUMN IF EXISTS bit_depth,
+    DROP COLUMN IF EXISTS has_alpha;
@@ -0,0 +1,7 @@
+-- Размеры и прозрачность изображения (для SVG — по viewBox)
+ALTER TABLE Images
+    ADD COLUMN width        INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN height       INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN aspect_ratio REAL NOT NULL DEFAULT 0,
+    ADD COLUMN bit_depth    SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN has_alpha    BOOLEAN NOT NULL DEFAULT FALSE;
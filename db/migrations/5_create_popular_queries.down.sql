@@ -0,0 +1 @@
+DROP TABLE IF EXISTS popular_queries;
@@ -0,0 +1,8 @@
+-- Популярные поисковые запросы для автодополнения
+CREATE TABLE popular_queries (
+                                 query     TEXT NOT NULL,
+                                 family    TEXT NOT NULL DEFAULT '',
+                                 hits      INTEGER NOT NULL DEFAULT 0,
+                                 last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                 PRIMARY KEY (query, family)
+);
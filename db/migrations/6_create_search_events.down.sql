@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_search_events_uuid_hash;
+DROP INDEX IF EXISTS idx_search_events_created_at;
+DROP TABLE IF EXISTS search_events;
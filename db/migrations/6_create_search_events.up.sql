@@ -0,0 +1,14 @@
+-- Журнал поисковых запросов для аналитики
+CREATE TABLE search_events (
+                               id               BIGSERIAL PRIMARY KEY,
+                               query            TEXT NOT NULL,
+                               family           TEXT NOT NULL DEFAULT '',
+                               result_count     INTEGER NOT NULL,
+                               uuid_hash        TEXT NOT NULL DEFAULT '',
+                               created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+                               clicked_image_id INTEGER REFERENCES Images(id) ON DELETE SET NULL,
+                               clicked_at       TIMESTAMPTZ
+);
+
+CREATE INDEX idx_search_events_created_at ON search_events (created_at);
+CREATE INDEX idx_search_events_uuid_hash ON search_events (uuid_hash, created_at);
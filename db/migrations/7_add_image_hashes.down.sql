@@ -0,0 +1,3 @@
+ALTER TABLE Images
+    DROP COLUMN IF EXISTS phash,
+    DROP COLUMN IF EXISTS dhash;
@@ -0,0 +1,4 @@
+-- Перцептивные хэши для поиска похожих изображений
+ALTER TABLE Images
+    ADD COLUMN phash BIGINT,
+    ADD COLUMN dhash BIGINT;
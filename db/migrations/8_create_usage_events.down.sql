@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS usage_events_sync_count ON usage_events;
+DROP FUNCTION IF EXISTS usage_events_sync_count();
+DROP TABLE IF EXISTS usage_events;
@@ -0,0 +1,27 @@
+-- Журнал использования изображений; usage_count в Images — материализованный агрегат этого журнала
+CREATE TABLE usage_events (
+                              id           BIGSERIAL PRIMARY KEY,
+                              image_id     INTEGER NOT NULL REFERENCES Images(id) ON DELETE CASCADE,
+                              license_uuid TEXT NOT NULL DEFAULT '',
+                              action       TEXT NOT NULL DEFAULT 'insert',
+                              created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_usage_events_image ON usage_events (image_id, created_at);
+CREATE INDEX idx_usage_events_license ON usage_events (license_uuid, created_at);
+CREATE INDEX idx_usage_events_created_at ON usage_events (created_at);
+
+CREATE FUNCTION usage_events_sync_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE Images SET usage_count = usage_count + 1 WHERE id = NEW.image_id;
+        RETURN NEW;
+    END IF;
+    UPDATE Images SET usage_count = GREATEST(usage_count - 1, 0) WHERE id = OLD.image_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER usage_events_sync_count
+    AFTER INSERT OR DELETE ON usage_events
+    FOR EACH ROW EXECUTE FUNCTION usage_events_sync_count();
@@ -0,0 +1,14 @@
+-- Популярность изображений за последние 1, 7 и 30 дней с экспоненциальным затуханием.
+-- Вес события: 0.5 ^ (возраст / период полураспада), период полураспада — треть окна.
+-- Обновляется сервером через REFRESH MATERIALIZED VIEW CONCURRENTLY.
+CREATE MATERIALIZED VIEW image_trending AS
+SELECT e.image_id,
+       w.days AS window_days,
+       SUM(power(0.5, EXTRACT(EPOCH FROM now() - e.created_at) / (w.days * 86400 / 3.0)))::float8 AS score,
+       COUNT(*) AS uses
+FROM usage_events e
+JOIN (VALUES (1), (7), (30)) AS w(days) ON e.created_at >= now() - w.days * INTERVAL '1 day'
+GROUP BY e.image_id, w.days;
+
+CREATE UNIQUE INDEX idx_image_trending_image_window ON image_trending (image_id, window_days);
+CREATE INDEX idx_image_trending_window_score ON image_trending (window_days, score DESC);
@@ -8,10 +8,15 @@ require (
 	github.com/lib/pq v1.10.9
 )
 
-require github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+require (
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/srwiley/oksvg v0.0.0-20200311192757-870daf9aa564
+	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
+	golang.org/x/image v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	golang.org/x/crypto v0.15.0 // indirect
-	golang.org/x/net v0.10.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,84 @@
+package bktree
+
+import "sort"
+
+// DistanceFunc — метрика (неотрицательная, симметричная, с неравенством треугольника)
+type DistanceFunc[T any] func(a, b T) int
+
+// Result — найденный элемент и его расстояние до запроса
+type Result[T any] struct {
+	Item     T
+	Distance int
+}
+
+type node[T any] struct {
+	item     T
+	children map[int]*node[T]
+}
+
+// Tree — BK-дерево для поиска ближайших элементов в дискретной метрике без полного перебора
+type Tree[T any] struct {
+	root     *node[T]
+	distance DistanceFunc[T]
+	size     int
+}
+
+func New[T any](distance DistanceFunc[T]) *Tree[T] {
+	return &Tree[T]{distance: distance}
+}
+
+func (t *Tree[T]) Add(item T) {
+	t.size++
+	if t.root == nil {
+		t.root = &node[T]{item: item}
+		return
+	}
+
+	n := t.root
+	for {
+		d := t.distance(item, n.item)
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*node[T])
+			}
+			n.children[d] = &node[T]{item: item}
+			return
+		}
+		n = child
+	}
+}
+
+// Search возвращает все элементы на расстоянии не больше radius, по возрастанию расстояния
+func (t *Tree[T]) Search(query T, radius int) []Result[T] {
+	var results []Result[T]
+	if t.root == nil {
+		return results
+	}
+
+	stack := []*node[T]{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := t.distance(query, n.item)
+		if d <= radius {
+			results = append(results, Result[T]{Item: n.item, Distance: d})
+		}
+		// По неравенству треугольника искомые элементы лежат только в поддеревьях [d-radius, d+radius]
+		for childDist, child := range n.children {
+			if childDist >= d-radius && childDist <= d+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+	return results
+}
+
+func (t *Tree[T]) Len() int {
+	return t.size
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultReportLimit = 20
+	maxReportLimit     = 500
+)
+
+type searchReportFunc func(from, to time.Time, limit int) ([]model.SearchQueryStat, error)
+
+// searchReport обслуживает отчёты поисковой аналитики: период задаётся from/to или days, размер — limit
+func searchReport(report searchReportFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parsePeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r, defaultReportLimit, maxReportLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stats, err := report(from, to, limit)
+		if err != nil {
+			log.Printf("Error building search report: %v", err)
+			http.Error(w, "Failed to build report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			log.Printf("Failed to encode search report to JSON: %v", err)
+			http.Error(w, "Failed to encode report to JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+func GetTopSearchQueries(s service.AnalyticsService) http.HandlerFunc {
+	return searchReport(s.GetTopQueries)
+}
+
+func GetZeroResultSearchQueries(s service.AnalyticsService) http.HandlerFunc {
+	return searchReport(s.GetZeroResultQueries)
+}
+
+func GetSearchClickThrough(s service.AnalyticsService) http.HandlerFunc {
+	return searchReport(s.GetClickThrough)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"HorizonBackend/internal/model"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// parseImageFilter читает из строки запроса фильтры по размерам, пропорциям, ориентации и прозрачности:
+// min_width, max_width, min_height, max_height, min_aspect, max_aspect, orientation, bit_depth, has_alpha
+func parseImageFilter(r *http.Request) (model.ImageFilter, error) {
+	var f model.ImageFilter
+	q := r.URL.Query()
+
+	ints := map[string]*int{
+		"min_width":  &f.MinWidth,
+		"max_width":  &f.MaxWidth,
+		"min_height": &f.MinHeight,
+		"max_height": &f.MaxHeight,
+		"bit_depth":  &f.BitDepth,
+	}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dst = n
+		}
+	}
+
+	floats := map[string]*float64{
+		"min_aspect": &f.MinAspect,
+		"max_aspect": &f.MaxAspect,
+	}
+	for name, dst := range floats {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dst = n
+		}
+	}
+
+	switch orientation := q.Get("orientation"); orientation {
+	case "", model.OrientationLandscape, model.OrientationPortrait, model.OrientationSquare:
+		f.Orientation = orientation
+	default:
+		return f, fmt.Errorf("invalid orientation parameter")
+	}
+
+	if v := q.Get("has_alpha"); v != "" {
+		hasAlpha, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid has_alpha parameter")
+		}
+		f.HasAlpha = &hasAlpha
+	}
+
+	return f, nil
+}
@@ -2,14 +2,18 @@ package handler
 
 import (
 	"HorizonBackend/config"
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/palette"
 	"HorizonBackend/internal/service"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -143,7 +147,13 @@ func GetImagesByFamilyGroupSubgroup(s service.ImageService, cfg *config.Config)
 		group := vars["group"]
 		subgroup := vars["subgroup"]
 
-		images, err := s.GetImagesByFamilyGroupSubgroup(family, group, subgroup)
+		filter, err := parseImageFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		images, err := s.GetImagesByFamilyGroupSubgroup(family, group, subgroup, filter)
 		if err != nil {
 			log.Printf("Error fetching images by family, group and subgroup: %v", err)
 			http.Error(w, "Failed to fetch images", http.StatusInternalServerError)
@@ -151,8 +161,7 @@ func GetImagesByFamilyGroupSubgroup(s service.ImageService, cfg *config.Config)
 		}
 
 		for i := range images {
-			images[i].FilePath = baseURL + images[i].FilePath
-			images[i].ThumbPath = baseURL + images[i].ThumbPath
+			withBaseURL(&images[i], baseURL)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -164,22 +173,56 @@ func GetImagesByFamilyGroupSubgroup(s service.ImageService, cfg *config.Config)
 	}
 }
 
-func SearchImages(s service.ImageService, cfg *config.Config) http.HandlerFunc {
+// Допустимое расстояние CIEDE2000 при поиске по цвету, если tolerance не указан
+const defaultColorTolerance = 20.0
+
+func SearchImages(s service.ImageService, suggestService service.SuggestService, analytics service.AnalyticsService, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		baseURL := cfg.BaseURL
 
 		keyword := r.URL.Query().Get("keyword")
 		family := r.URL.Query().Get("family")
 
-		images, err := s.SearchImages(keyword, family)
+		filter, err := parseImageFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var images []model.Image
+		if colorStr := r.URL.Query().Get("color"); colorStr != "" {
+			// Поиск по цвету: /search?color=#1fa3a3&tolerance=15 (можно вместе с keyword и family)
+			color, parseErr := palette.ParseHex(colorStr)
+			if parseErr != nil {
+				http.Error(w, "Invalid color parameter", http.StatusBadRequest)
+				return
+			}
+
+			tolerance := defaultColorTolerance
+			if toleranceStr := r.URL.Query().Get("tolerance"); toleranceStr != "" {
+				tolerance, parseErr = strconv.ParseFloat(toleranceStr, 64)
+				if parseErr != nil || tolerance < 0 {
+					http.Error(w, "Invalid tolerance parameter", http.StatusBadRequest)
+					return
+				}
+			}
+
+			images, err = s.SearchImagesByColor(keyword, family, color, tolerance, filter)
+		} else {
+			images, err = s.SearchImages(keyword, family, filter)
+		}
 		if err != nil {
 			http.Error(w, "Failed to fetch images", http.StatusInternalServerError)
 			return
 		}
 
+		if keyword != "" {
+			suggestService.RecordQuery(keyword, family, len(images))
+			analytics.RecordSearch(keyword, family, requestUUID(r), len(images))
+		}
+
 		for i := range images {
-			images[i].FilePath = baseURL + images[i].FilePath
-			images[i].ThumbPath = baseURL + images[i].ThumbPath
+			withBaseURL(&images[i], baseURL)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -195,24 +238,58 @@ type ImageResponse struct {
 	FilePath string `json:"file_path"`
 }
 
-func IncreaseImageUsage(service service.ImageService) http.HandlerFunc {
+// normalizeThumbPath приводит путь, присланный клиентом, к виду из базы (static/images/...):
+// убирает BaseURL, схему и хост абсолютного URL и ведущий слэш
+func normalizeThumbPath(raw, baseURL string) string {
+	path := strings.TrimPrefix(raw, baseURL)
+	// mux схлопывает "//" в пути, поэтому "http://host/..." приходит как "http:/host/..."
+	if i := strings.Index(path, staticImagesPrefix); i > 0 && strings.Contains(path[:i], ":") {
+		path = path[i:]
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+const staticImagesPrefix = "static/images/"
+
+// IncreaseImageUsage — устаревший способ записать использование по пути миниатюры.
+// Используйте POST /images/{id}/usage или POST /usage/batch.
+func IncreaseImageUsage(usage service.UsageService, analytics service.AnalyticsService, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("IncreaseImageUsage handler called")
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", `</images/{id}/usage>; rel="successor-version"`)
+
 		vars := mux.Vars(r)
 		thumbPath, ok := vars["thumbPath"]
-		fmt.Printf("Extracted thumbPath: %s, success: %v\n", thumbPath, ok)
-
-		if !ok {
+		if !ok || thumbPath == "" {
 			http.Error(w, "Thumb path is required", http.StatusBadRequest)
 			return
 		}
+		thumbPath = normalizeThumbPath(thumbPath, cfg.BaseURL)
+
+		// action — что пользователь сделал с изображением: insert (по умолчанию) или replace
+		action := r.URL.Query().Get("action")
+		if action != "" && !service.ValidUsageAction(action) {
+			http.Error(w, "Invalid action parameter", http.StatusBadRequest)
+			return
+		}
 
-		err := service.IncreaseUsageCount(thumbPath)
+		uuid := requestUUID(r)
+		imageID, err := usage.RecordUsage(thumbPath, uuid, action)
+		if errors.Is(err, service.ErrLicenseRequired) {
+			http.Error(w, "Valid license required", http.StatusForbidden)
+			return
+		}
 		if err != nil {
-			fmt.Printf("Error increasing usage count: %v\n", err)
+			log.Printf("Error increasing usage count: %v", err)
 			http.Error(w, fmt.Sprintf("Error increasing usage count: %v", err), http.StatusInternalServerError)
 			return
 		}
+		if imageID == 0 {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+
+		analytics.RecordClick(uuid, imageID)
 
 		w.Write([]byte("Usage count increased"))
 	}
@@ -272,10 +349,16 @@ func GetLeastUsedImages(s service.ImageService, cfg *config.Config) http.Handler
 			count = 6
 		}
 
+		filter, err := parseImageFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Логирование входящих параметров
 		log.Printf("Fetching least used images for family: %s and count: %d", family, count)
 
-		images, err := s.GetLeastUsedImages(family, count)
+		images, err := s.GetLeastUsedImages(family, requestUUID(r), count, filter)
 		if err != nil {
 			log.Printf("Error fetching least used images: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -286,8 +369,7 @@ func GetLeastUsedImages(s service.ImageService, cfg *config.Config) http.Handler
 		log.Printf("Fetched %d images", len(images))
 
 		for i := range images {
-			images[i].FilePath = cfg.BaseURL + images[i].FilePath
-			images[i].ThumbPath = cfg.BaseURL + images[i].ThumbPath
+			withBaseURL(&images[i], cfg.BaseURL)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"HorizonBackend/internal/service"
+	"net/http"
+)
+
+// RebuildIndexes перестраивает индексы автодополнения и похожих изображений; вызывается cmd/ingest
+// после загрузки каталога
+func RebuildIndexes(s service.IndexService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Rebuild(); err != nil {
+			http.Error(w, "Failed to rebuild indexes", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type renameRequest struct {
+	Name string `json:"name"`
+}
+
+type renameResponse struct {
+	Name        string `json:"name"`
+	MovedImages int    `json:"moved_images"`
+}
+
+type moveImageRequest struct {
+	Family   string `json:"family"`
+	Group    string `json:"group"`
+	Subgroup string `json:"subgroup"`
+}
+
+// writeOrganizeError отвечает на ошибку переименования, переноса или удаления
+func writeOrganizeError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, service.ErrTaxonomyNotFound), errors.Is(err, service.ErrImageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrCatalogConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, failure, http.StatusInternalServerError)
+	}
+}
+
+// RenameTaxonomy переименовывает семейство, группу или подгруппу из пути запроса в name из тела
+func RenameTaxonomy(s service.OrganizeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		path := []string{vars["family"]}
+		for _, level := range []string{"group", "subgroup"} {
+			if name, ok := vars[level]; ok {
+				path = append(path, name)
+			}
+		}
+
+		var body renameRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		body.Name = strings.TrimSpace(body.Name)
+
+		moved, err := s.RenameTaxonomy(r.Context(), path, body.Name)
+		if err != nil {
+			writeOrganizeError(w, err, "Failed to rename")
+			return
+		}
+		writeJSON(w, http.StatusOK, renameResponse{Name: body.Name, MovedImages: moved})
+	}
+}
+
+// MoveImage переносит изображение в подгруппу из тела запроса под следующим номером
+func MoveImage(s service.OrganizeService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid image id", http.StatusBadRequest)
+			return
+		}
+
+		var body moveImageRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		img, err := s.MoveImage(r.Context(), imageID, strings.TrimSpace(body.Family), strings.TrimSpace(body.Group), strings.TrimSpace(body.Subgroup))
+		if err != nil {
+			writeOrganizeError(w, err, "Failed to move image")
+			return
+		}
+		withBaseURL(&img, cfg.BaseURL)
+		writeJSON(w, http.StatusOK, img)
+	}
+}
+
+// DeleteImage удаляет изображение, его файлы и историю его использования
+func DeleteImage(s service.OrganizeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid image id", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.DeleteImage(r.Context(), imageID); err != nil {
+			writeOrganizeError(w, err, "Failed to delete image")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
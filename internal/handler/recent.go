@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+const (
+	defaultRecentLimit = 20
+	maxRecentLimit     = 100
+)
+
+// GetRecentImages возвращает изображения, которые вызывающий UUID использовал последними
+func GetRecentImages(s service.RecentService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid := requestUUID(r)
+		if uuid == "" {
+			http.Error(w, "License UUID is required", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r, defaultRecentLimit, maxRecentLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		images, err := s.GetRecentImages(uuid, limit)
+		if errors.Is(err, service.ErrLicenseRequired) {
+			http.Error(w, "Valid license required", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch recent images", http.StatusInternalServerError)
+			return
+		}
+
+		for i := range images {
+			withBaseURL(&images[i], cfg.BaseURL)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(images); err != nil {
+			log.Printf("Failed to encode images to JSON: %v", err)
+			http.Error(w, "Failed to encode images to JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+// ClearRecentImages очищает историю недавно использованных изображений вызывающего UUID
+func ClearRecentImages(s service.RecentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid := requestUUID(r)
+		if uuid == "" {
+			http.Error(w, "License UUID is required", http.StatusBadRequest)
+			return
+		}
+
+		err := s.ClearHistory(uuid)
+		if errors.Is(err, service.ErrLicenseRequired) {
+			http.Error(w, "Valid license required", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to clear recent images", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRecommendationLimit = 12
+	maxRecommendationLimit     = 50
+)
+
+// GetRecommendations возвращает изображения из других семейств, которые часто используют вместе с {id}
+func GetRecommendations(s service.RecommendationService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid image id", http.StatusBadRequest)
+			return
+		}
+		family := r.URL.Query().Get("family")
+
+		limit, err := parseLimit(r, defaultRecommendationLimit, maxRecommendationLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseImageFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		images, err := s.GetRecommendations(imageID, family, limit, filter)
+		if errors.Is(err, service.ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch recommendations", http.StatusInternalServerError)
+			return
+		}
+
+		for i := range images {
+			withBaseURL(&images[i], cfg.BaseURL)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(images); err != nil {
+			log.Printf("Failed to encode images to JSON: %v", err)
+			http.Error(w, "Failed to encode images to JSON", http.StatusInternalServerError)
+		}
+	}
+}
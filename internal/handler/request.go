@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"HorizonBackend/internal/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовок, в котором плагин передаёт UUID лицензии
+const uuidHeader = "X-License-UUID"
+
+// requestUUID возвращает UUID лицензии вызывающего: из заголовка X-License-UUID или параметра uuid
+func requestUUID(r *http.Request) string {
+	if uuid := strings.TrimSpace(r.Header.Get(uuidHeader)); uuid != "" {
+		return uuid
+	}
+	return strings.TrimSpace(r.URL.Query().Get("uuid"))
+}
+
+const (
+	defaultReportDays = 30
+	dateLayout        = "2006-01-02"
+	monthLayout       = "2006-01"
+)
+
+// parsePeriod читает период отчёта: from и to в формате YYYY-MM-DD (to не включается),
+// days — последние N дней или month — календарный месяц YYYY-MM. По умолчанию — последние 30 дней.
+func parsePeriod(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -defaultReportDays)
+
+	if daysStr := q.Get("days"); daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days <= 0 {
+			return from, to, fmt.Errorf("invalid days parameter")
+		}
+		from = to.AddDate(0, 0, -days)
+	}
+	if monthStr := q.Get("month"); monthStr != "" {
+		t, err := time.Parse(monthLayout, monthStr)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid month parameter, expected YYYY-MM")
+		}
+		from, to = t, t.AddDate(0, 1, 0)
+	}
+	if fromStr := q.Get("from"); fromStr != "" {
+		t, err := time.Parse(dateLayout, fromStr)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from parameter, expected YYYY-MM-DD")
+		}
+		from = t
+	}
+	if toStr := q.Get("to"); toStr != "" {
+		t, err := time.Parse(dateLayout, toStr)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to parameter, expected YYYY-MM-DD")
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+
+	return from, to, nil
+}
+
+// parseLimit читает параметр limit с значением по умолчанию и верхней границей
+func parseLimit(r *http.Request, def, max int) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit parameter")
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit, nil
+}
+
+// writeJSON отправляет v в формате JSON с указанным статусом
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response to JSON: %v", err)
+	}
+}
+
+// withBaseURL превращает пути файлов изображения и его миниатюр в абсолютные URL
+func withBaseURL(img *model.Image, baseURL string) {
+	img.FilePath = baseURL + img.FilePath
+	img.ThumbPath = baseURL + img.ThumbPath
+	for name, t := range img.Thumbnails {
+		t.Path = baseURL + t.Path
+		img.Thumbnails[name] = t
+	}
+}
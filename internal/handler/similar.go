@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultSimilarLimit = 12
+	maxSimilarLimit     = 50
+)
+
+func GetSimilarImages(s service.SimilarService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid image id", http.StatusBadRequest)
+			return
+		}
+		family := r.URL.Query().Get("family")
+
+		limit, err := parseLimit(r, defaultSimilarLimit, maxSimilarLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		images, err := s.FindSimilar(imageID, family, limit)
+		if errors.Is(err, service.ErrImageNotIndexed) {
+			http.Error(w, "Image not found or has no perceptual hash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching similar images: %v", err)
+			http.Error(w, "Failed to fetch images", http.StatusInternalServerError)
+			return
+		}
+
+		for i := range images {
+			withBaseURL(&images[i], cfg.BaseURL)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(images); err != nil {
+			log.Printf("Failed to encode images to JSON: %v", err)
+			http.Error(w, "Failed to encode images to JSON", http.StatusInternalServerError)
+		}
+	}
+}
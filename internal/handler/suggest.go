@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+func SuggestSearch(s service.SuggestService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		family := r.URL.Query().Get("family")
+
+		limit, err := parseLimit(r, defaultSuggestLimit, maxSuggestLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		suggestions := s.Suggest(prefix, family, limit)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+			log.Printf("Failed to encode suggestions to JSON: %v", err)
+			http.Error(w, "Failed to encode suggestions to JSON", http.StatusInternalServerError)
+		}
+	}
+}
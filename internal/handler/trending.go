@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const (
+	defaultTrendingWindow = "7d"
+	defaultTrendingLimit  = 6
+	maxTrendingLimit      = 100
+)
+
+func GetTrendingImages(s service.TrendingService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		family := r.URL.Query().Get("family")
+
+		window := r.URL.Query().Get("window")
+		if window == "" {
+			window = defaultTrendingWindow
+		}
+		windowDays, ok := service.TrendingWindows[window]
+		if !ok {
+			http.Error(w, "Invalid window parameter, expected 1d, 7d or 30d", http.StatusBadRequest)
+			return
+		}
+
+		limit, err := parseLimit(r, defaultTrendingLimit, maxTrendingLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseImageFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		images, err := s.GetTrendingImages(family, windowDays, limit, filter)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		for i := range images {
+			withBaseURL(&images[i], cfg.BaseURL)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(images); err != nil {
+			log.Printf("Failed to encode images to JSON: %v", err)
+			http.Error(w, "Failed to encode images to JSON", http.StatusInternalServerError)
+		}
+	}
+}
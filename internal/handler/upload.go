@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"HorizonBackend/config"
+	"HorizonBackend/internal/service"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Максимальный размер загружаемого файла
+	maxUploadSize = 32 << 20
+	// Сколько multipart-данных держать в памяти; остальное пишется во временные файлы
+	uploadMemory = 8 << 20
+)
+
+// UploadImage принимает multipart/form-data с полями family, group, subgroup и файлом file.
+// Изображение получает следующий номер в подгруппе; ответ — 201 с изображением и предупреждениями.
+func UploadImage(s service.UploadService, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Запас на поля формы и заголовки частей
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+		if err := r.ParseMultipartForm(uploadMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if header.Size > maxUploadSize {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		family := strings.TrimSpace(r.FormValue("family"))
+		group := strings.TrimSpace(r.FormValue("group"))
+		subgroup := strings.TrimSpace(r.FormValue("subgroup"))
+
+		result, err := s.Upload(r.Context(), family, group, subgroup, header.Filename, file)
+		if errors.Is(err, service.ErrInvalidUpload) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error uploading image: %v", err)
+			http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+			return
+		}
+
+		withBaseURL(&result.Image, cfg.BaseURL)
+		writeJSON(w, http.StatusCreated, result)
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultUsageEventsLimit = 100
+	maxUsageEventsLimit     = 1000
+)
+
+type usageEventsResponse struct {
+	Total  int                `json:"total"`
+	Events []model.UsageEvent `json:"events"`
+}
+
+// GetUsageEvents возвращает журнал использования с фильтрами image_id, uuid, action и периодом from/to или days
+func GetUsageEvents(s service.UsageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parsePeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r, defaultUsageEventsLimit, maxUsageEventsLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filter := model.UsageEventFilter{
+			LicenseUUID: r.URL.Query().Get("uuid"),
+			Action:      r.URL.Query().Get("action"),
+			From:        from,
+			To:          to,
+			Limit:       limit,
+		}
+		if imageIDStr := r.URL.Query().Get("image_id"); imageIDStr != "" {
+			filter.ImageID, err = strconv.Atoi(imageIDStr)
+			if err != nil || filter.ImageID <= 0 {
+				http.Error(w, "Invalid image_id parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, total, err := s.GetUsageEvents(filter)
+		if err != nil {
+			log.Printf("Error fetching usage events: %v", err)
+			http.Error(w, "Failed to fetch usage events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(usageEventsResponse{Total: total, Events: events}); err != nil {
+			log.Printf("Failed to encode usage events to JSON: %v", err)
+			http.Error(w, "Failed to encode usage events to JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+const (
+	defaultSpikeWindowHours  = 1
+	maxSpikeWindowHours      = int(service.MaxSpikeWindow / time.Hour)
+	defaultSpikeBaselineDays = 7
+	defaultSpikeFactor       = 5
+	defaultSpikeMinEvents    = 20
+	defaultSpikeLimit        = 50
+	maxSpikeLimit            = 500
+)
+
+// GetUsageSpikes возвращает отчёт о всплесках использования: hours — окно (по умолчанию 1),
+// baseline_days — базовый период (по умолчанию 7), factor — во сколько раз выросло использование
+// (по умолчанию 5), min_events — минимум событий за окно (по умолчанию 20)
+func GetUsageSpikes(s service.UsageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params := model.UsageSpikeParams{
+			Window:    defaultSpikeWindowHours * time.Hour,
+			Baseline:  defaultSpikeBaselineDays * 24 * time.Hour,
+			Factor:    defaultSpikeFactor,
+			MinEvents: defaultSpikeMinEvents,
+		}
+
+		if v := q.Get("hours"); v != "" {
+			hours, err := strconv.Atoi(v)
+			if err != nil || hours <= 0 || hours > maxSpikeWindowHours {
+				http.Error(w, fmt.Sprintf("hours must be between 1 and %d", maxSpikeWindowHours), http.StatusBadRequest)
+				return
+			}
+			params.Window = time.Duration(hours) * time.Hour
+		}
+		if v := q.Get("baseline_days"); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil || days <= 0 {
+				http.Error(w, "Invalid baseline_days parameter", http.StatusBadRequest)
+				return
+			}
+			params.Baseline = time.Duration(days) * 24 * time.Hour
+		}
+		if v := q.Get("factor"); v != "" {
+			factor, err := strconv.ParseFloat(v, 64)
+			if err != nil || factor < 1 {
+				http.Error(w, "factor must be a number not less than 1", http.StatusBadRequest)
+				return
+			}
+			params.Factor = factor
+		}
+		if v := q.Get("min_events"); v != "" {
+			minEvents, err := strconv.Atoi(v)
+			if err != nil || minEvents <= 0 {
+				http.Error(w, "Invalid min_events parameter", http.StatusBadRequest)
+				return
+			}
+			params.MinEvents = minEvents
+		}
+		limit, err := parseLimit(r, defaultSpikeLimit, maxSpikeLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Limit = limit
+
+		report, err := s.GetSpikeReport(params)
+		if err != nil {
+			http.Error(w, "Failed to build usage spike report", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+type usageRequest struct {
+	Count  int    `json:"count"`
+	Action string `json:"action"`
+}
+
+// GetUsageBufferStats возвращает счётчики буфера использований: ожидающие записи и записанные события
+func GetUsageBufferStats(s service.UsageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.BufferStats())
+	}
+}
+
+// RecordImageUsage обрабатывает POST /images/{id}/usage с необязательным телом {"count": 1, "action": "insert"}
+func RecordImageUsage(s service.UsageService, analytics service.AnalyticsService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid image id", http.StatusBadRequest)
+			return
+		}
+
+		var body usageRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		uuid := requestUUID(r)
+		result, err := s.RecordImageUsage(uuid, model.UsageItem{ImageID: imageID, Count: body.Count, Action: body.Action})
+		switch {
+		case errors.Is(err, service.ErrLicenseRequired):
+			http.Error(w, "Valid license required", http.StatusForbidden)
+			return
+		case errors.Is(err, service.ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Failed to record usage", http.StatusInternalServerError)
+			return
+		case result.Status == model.UsageStatusInvalid:
+			http.Error(w, result.Error, http.StatusBadRequest)
+			return
+		}
+
+		if result.Status == model.UsageStatusOK {
+			analytics.RecordClick(uuid, imageID)
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+type usageBatchRequest struct {
+	Items []model.UsageItem `json:"items"`
+}
+
+type usageBatchResponse struct {
+	Results []model.UsageResult `json:"results"`
+}
+
+// RecordUsageBatch обрабатывает POST /usage/batch с телом {"items": [{"image_id": 1, "count": 2}]}
+// и возвращает результат по каждому элементу
+func RecordUsageBatch(s service.UsageService, analytics service.AnalyticsService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body usageBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(body.Items) == 0 {
+			http.Error(w, "items must not be empty", http.StatusBadRequest)
+			return
+		}
+		if len(body.Items) > service.MaxUsageBatch {
+			http.Error(w, fmt.Sprintf("too many items, max %d", service.MaxUsageBatch), http.StatusBadRequest)
+			return
+		}
+
+		uuid := requestUUID(r)
+		results, err := s.RecordUsageBatch(uuid, body.Items)
+		if errors.Is(err, service.ErrLicenseRequired) {
+			http.Error(w, "Valid license required", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to record usage", http.StatusInternalServerError)
+			return
+		}
+
+		for _, res := range results {
+			if res.Status == model.UsageStatusOK {
+				analytics.RecordClick(uuid, res.ImageID)
+				break
+			}
+		}
+		writeJSON(w, http.StatusOK, usageBatchResponse{Results: results})
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/service"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// GetUsageReport отдаёт отчёт об использовании: level — family, group, subgroup (по умолчанию) или image,
+// family — фильтр по семейству, период — from/to, days или month, format — json (по умолчанию) или csv
+func GetUsageReport(s service.UsageReportService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		level := q.Get("level")
+		if level == "" {
+			level = model.UsageReportSubgroup
+		}
+		if !service.ValidUsageReportLevel(level) {
+			http.Error(w, service.ErrInvalidReportLevel.Error(), http.StatusBadRequest)
+			return
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+			return
+		}
+		from, to, err := parsePeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := s.GetUsageReport(level, q.Get("family"), from, to)
+		if err != nil {
+			http.Error(w, "Failed to build usage report", http.StatusInternalServerError)
+			return
+		}
+
+		if format == "json" {
+			writeJSON(w, http.StatusOK, report)
+			return
+		}
+
+		filename := fmt.Sprintf("usage_%s_%s_%s.csv", level, from.Format(dateLayout), to.Format(dateLayout))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if err := service.WriteUsageReportCSV(w, level, report); err != nil {
+			log.Printf("Failed to write usage report CSV: %v", err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type Family struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
@@ -18,11 +20,257 @@ type Subgroup struct {
 }
 
 type Image struct {
-	ID         int      `json:"id"`
-	SubgroupID int      `json:"subgroup_id"`
-	Name       string   `json:"name"`
-	FilePath   string   `json:"file_path"`
-	ThumbPath  string   `json:"thumb_path"`
-	UsageCount int      `json:"usage_count"`
-	MetaTags   []string `json:"meta_tags"`
+	ID          int      `json:"id"`
+	SubgroupID  int      `json:"subgroup_id"`
+	Name        string   `json:"name"`
+	FilePath    string   `json:"file_path"`
+	ThumbPath   string   `json:"thumb_path"`
+	UsageCount  int      `json:"usage_count"`
+	MetaTags    []string `json:"meta_tags"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Author      string   `json:"author"`
+	License     string   `json:"license"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	AspectRatio float64  `json:"aspect_ratio"`
+	Orientation string   `json:"orientation"`
+	BitDepth    int      `json:"bit_depth"`
+	HasAlpha    bool     `json:"has_alpha"`
+	// Формат исходного файла: jpeg, png, gif, webp, tiff, bmp или svg
+	Format   string `json:"format"`
+	Animated bool   `json:"animated"`
+	// Растёт при замене файла изображения или миниатюры; годится для сброса кэшей
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Миниатюры разных размеров по имени (small, medium, large...)
+	Thumbnails map[string]Rendition `json:"thumbnails,omitempty"`
+
+	Palette []ImageColor `json:"palette,omitempty"`
+}
+
+// Rendition — миниатюра изображения одного размера
+type Rendition struct {
+	Path   string `json:"path"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+// OrientationOf определяет ориентацию по размерам; для неизвестных размеров возвращает пустую строку
+func OrientationOf(width, height int) string {
+	switch {
+	case width == 0 || height == 0:
+		return ""
+	case width > height:
+		return OrientationLandscape
+	case width < height:
+		return OrientationPortrait
+	default:
+		return OrientationSquare
+	}
+}
+
+// ImageFilter — дополнительные условия выборки изображений. Нулевые значения не ограничивают выборку.
+type ImageFilter struct {
+	MinWidth    int
+	MaxWidth    int
+	MinHeight   int
+	MaxHeight   int
+	MinAspect   float64
+	MaxAspect   float64
+	Orientation string
+	BitDepth    int
+	HasAlpha    *bool
+}
+
+type ImageColor struct {
+	Hex    string  `json:"hex"`
+	L      float64 `json:"-"`
+	A      float64 `json:"-"`
+	B      float64 `json:"-"`
+	Weight float64 `json:"weight"`
+}
+
+const (
+	SuggestionTag      = "tag"
+	SuggestionFamily   = "family"
+	SuggestionGroup    = "group"
+	SuggestionSubgroup = "subgroup"
+	SuggestionQuery    = "query"
+)
+
+// Suggestion — вариант автодополнения поискового запроса
+type Suggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+	Hits int    `json:"hits"`
+}
+
+// SuggestionSource — термин для индекса автодополнения с числом совпадений в семействе
+type SuggestionSource struct {
+	Text   string
+	Type   string
+	Family string
+	Hits   int
+}
+
+// SearchQueryStat — агрегированная статистика по поисковому запросу за период
+type SearchQueryStat struct {
+	Query            string  `json:"query"`
+	Family           string  `json:"family"`
+	Searches         int     `json:"searches"`
+	Users            int     `json:"users"`
+	AvgResults       float64 `json:"avg_results"`
+	Clicks           int     `json:"clicks"`
+	ClickThroughRate float64 `json:"click_through_rate"`
+}
+
+// ImageHash — перцептивные хэши изображения для поиска похожих
+type ImageHash struct {
+	ImageID int
+	Family  string
+	Visible bool
+	PHash   uint64
+	DHash   uint64
+}
+
+const (
+	UsageActionInsert  = "insert"
+	UsageActionReplace = "replace"
+	// Использования, записанные в usage_count до появления журнала (перенесены миграцией с датой 1970-01-01)
+	UsageActionLegacy = "legacy"
+)
+
+// UsageEvent — одно использование изображения в плагине
+type UsageEvent struct {
+	ID          int64     `json:"id"`
+	ImageID     int       `json:"image_id"`
+	LicenseUUID string    `json:"license_uuid"`
+	Action      string    `json:"action"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UsageItem — запрос на запись использования изображения (count раз)
+type UsageItem struct {
+	ImageID int    `json:"image_id"`
+	Count   int    `json:"count"`
+	Action  string `json:"action"`
+}
+
+const (
+	UsageStatusOK       = "ok"
+	UsageStatusNotFound = "not_found"
+	UsageStatusInvalid  = "invalid"
+	// Изображение уже использовано этим UUID в окне дедупликации, использование не засчитано
+	UsageStatusDuplicate = "duplicate"
+)
+
+// UsageResult — результат записи использования для одного изображения
+type UsageResult struct {
+	ImageID    int    `json:"image_id"`
+	Status     string `json:"status"`
+	Recorded   int    `json:"recorded"`
+	UsageCount int    `json:"usage_count,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PendingUsage — накопленные в памяти, ещё не записанные использования изображения
+type PendingUsage struct {
+	ImageID     int
+	LicenseUUID string
+	Action      string
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// UsageBufferStats — состояние буфера записи использования
+type UsageBufferStats struct {
+	PendingEvents  int       `json:"pending_events"`
+	FlushedEvents  int64     `json:"flushed_events"`
+	DroppedEvents  int64     `json:"dropped_events"`
+	Flushes        int64     `json:"flushes"`
+	FailedFlushes  int64     `json:"failed_flushes"`
+	LastFlushAt    time.Time `json:"last_flush_at"`
+	LastFlushError string    `json:"last_flush_error,omitempty"`
+}
+
+// UsageSpikeParams — параметры поиска всплесков использования: события за последние Window
+// сравниваются со средним за такое же окно в предыдущие Baseline
+type UsageSpikeParams struct {
+	Window    time.Duration
+	Baseline  time.Duration
+	Factor    float64
+	MinEvents int
+	Limit     int
+}
+
+// ImageUsageSpike — изображение, использование которого за окно резко выросло
+type ImageUsageSpike struct {
+	ImageID   int     `json:"image_id"`
+	ThumbPath string  `json:"thumb_path"`
+	Events    int     `json:"events"`
+	Licenses  int     `json:"licenses"`
+	Expected  float64 `json:"expected"`
+	Ratio     float64 `json:"ratio"`
+}
+
+// LicenseUsageSpike — лицензия с аномально большим числом использований или отклонённых повторов
+type LicenseUsageSpike struct {
+	LicenseUUID string  `json:"license_uuid"`
+	Events      int     `json:"events"`
+	Images      int     `json:"images"`
+	Expected    float64 `json:"expected"`
+	Ratio       float64 `json:"ratio"`
+	Duplicates  int64   `json:"duplicates"`
+}
+
+// UsageSpikeReport — отчёт о подозрительной активности
+type UsageSpikeReport struct {
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	Images     []ImageUsageSpike   `json:"images"`
+	Licenses   []LicenseUsageSpike `json:"licenses"`
+	Duplicates int64               `json:"duplicates_rejected"`
+	Unlicensed int64               `json:"unlicensed_rejected"`
+}
+
+const (
+	UsageReportFamily   = "family"
+	UsageReportGroup    = "group"
+	UsageReportSubgroup = "subgroup"
+	UsageReportImage    = "image"
+)
+
+// UsageReportRow — использование изображений за период на уровне изображения, подгруппы,
+// группы или семейства. Поля ниже уровня отчёта пустые.
+type UsageReportRow struct {
+	Family     string `json:"family"`
+	Group      string `json:"group,omitempty"`
+	Subgroup   string `json:"subgroup,omitempty"`
+	ImageID    int    `json:"image_id,omitempty"`
+	FilePath   string `json:"file_path,omitempty"`
+	Images     int    `json:"images"`
+	UsedImages int    `json:"used_images"`
+	Events     int    `json:"events"`
+	Inserts    int    `json:"inserts"`
+	Replaces   int    `json:"replaces"`
+	Licenses   int    `json:"licenses"`
+}
+
+// UsageEventFilter — условия выборки событий использования. Нулевые значения не ограничивают выборку.
+type UsageEventFilter struct {
+	ImageID     int
+	LicenseUUID string
+	Action      string
+	From        time.Time
+	To          time.Time
+	Limit       int
 }
@@ -0,0 +1,162 @@
+package palette
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Lab — координаты цвета в пространстве CIE Lab (D65)
+type Lab struct {
+	L, A, B float64
+}
+
+// Color — цвет палитры в sRGB и его представление в Lab
+type Color struct {
+	R, G, B uint8
+	Lab     Lab
+}
+
+// Swatch — цвет палитры и доля изображения, которую он занимает (0..1)
+type Swatch struct {
+	Color  Color
+	Weight float64
+}
+
+// NewColor строит цвет по компонентам sRGB и сразу считает Lab
+func NewColor(r, g, b uint8) Color {
+	return Color{R: r, G: g, B: b, Lab: rgbToLab(r, g, b)}
+}
+
+// Hex возвращает цвет в виде #rrggbb
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ParseHex разбирает цвет вида #rgb, #rrggbb (решётка необязательна)
+func ParseHex(s string) (Color, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return Color{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return NewColor(uint8(v>>16), uint8(v>>8), uint8(v)), nil
+}
+
+func linearize(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+func rgbToLab(r, g, b uint8) Lab {
+	rl, gl, bl := linearize(r), linearize(g), linearize(b)
+
+	x := (0.4124564*rl + 0.3575761*gl + 0.1804375*bl) / 0.95047
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := (0.0193339*rl + 0.1191920*gl + 0.9503041*bl) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// DeltaE76 — евклидово расстояние в Lab, дешёвое и достаточное для слияния близких цветов
+func DeltaE76(c1, c2 Lab) float64 {
+	dl, da, db := c1.L-c2.L, c1.A-c2.A, c1.B-c2.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// DeltaE2000 — перцептивное расстояние между цветами по формуле CIEDE2000
+func DeltaE2000(c1, c2 Lab) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	l1, a1, b1 := c1.L, c1.A, c1.B
+	l2, a2, b2 := c2.L, c2.A, c2.B
+
+	cAvg := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	cAvg7 := math.Pow(cAvg, 7)
+	g := 0.5 * (1 - math.Sqrt(cAvg7/(cAvg7+pow25to7)))
+
+	a1p, a2p := (1+g)*a1, (1+g)*a2
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+	h1p, h2p := hueAngle(b1, a1p), hueAngle(b2, a2p)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+
+	var dhp float64
+	switch {
+	case c1p*c2p == 0:
+		dhp = 0
+	case math.Abs(h2p-h1p) <= 180:
+		dhp = h2p - h1p
+	case h2p-h1p > 180:
+		dhp = h2p - h1p - 360
+	default:
+		dhp = h2p - h1p + 360
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(deg2rad(dhp/2))
+
+	lAvgp := (l1 + l2) / 2
+	cAvgp := (c1p + c2p) / 2
+
+	var hAvgp float64
+	switch {
+	case c1p*c2p == 0:
+		hAvgp = h1p + h2p
+	case math.Abs(h1p-h2p) <= 180:
+		hAvgp = (h1p + h2p) / 2
+	case h1p+h2p < 360:
+		hAvgp = (h1p + h2p + 360) / 2
+	default:
+		hAvgp = (h1p + h2p - 360) / 2
+	}
+
+	t := 1 - 0.17*math.Cos(deg2rad(hAvgp-30)) +
+		0.24*math.Cos(deg2rad(2*hAvgp)) +
+		0.32*math.Cos(deg2rad(3*hAvgp+6)) -
+		0.20*math.Cos(deg2rad(4*hAvgp-63))
+
+	dTheta := 30 * math.Exp(-math.Pow((hAvgp-275)/25, 2))
+	cAvgp7 := math.Pow(cAvgp, 7)
+	rc := 2 * math.Sqrt(cAvgp7/(cAvgp7+pow25to7))
+	lTerm := (lAvgp - 50) * (lAvgp - 50)
+	sl := 1 + 0.015*lTerm/math.Sqrt(20+lTerm)
+	sc := 1 + 0.045*cAvgp
+	sh := 1 + 0.015*cAvgp*t
+	rt := -math.Sin(deg2rad(2*dTheta)) * rc
+
+	dl, dc, dh := dLp/sl, dCp/sc, dHp/sh
+	return math.Sqrt(dl*dl + dc*dc + dh*dh + rt*dc*dh)
+}
+
+func hueAngle(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func deg2rad(d float64) float64 {
+	return d * math.Pi / 180
+}
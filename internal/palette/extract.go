@@ -0,0 +1,183 @@
+package palette
+
+import (
+	"image"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Сколько пикселей по каждой стороне берём из изображения, чтобы не обходить его целиком
+	sampleSide = 96
+	// Цвета ближе этого расстояния (ΔE76) считаются одним цветом палитры
+	mergeDistance = 12.0
+	// Пиксели прозрачнее этого порога (из 0xffff) не учитываются
+	minAlpha = 0x8000
+)
+
+type bucket struct {
+	r, g, b uint64
+	count   uint64
+}
+
+// FromImage извлекает до n доминирующих цветов растрового изображения.
+// Пиксели квантуются в 4096 корзин (по 4 бита на канал), затем близкие корзины сливаются.
+func FromImage(img image.Image, n int) []Swatch {
+	bounds := img.Bounds()
+	stepX := bounds.Dx()/sampleSide + 1
+	stepY := bounds.Dy()/sampleSide + 1
+
+	buckets := make(map[uint16]*bucket)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < minAlpha {
+				continue
+			}
+			// RGBA() возвращает компоненты, умноженные на альфу; возвращаем их к 8 битам
+			r8, g8, b8 := uint8(r*0xffff/a>>8), uint8(g*0xffff/a>>8), uint8(b*0xffff/a>>8)
+			key := uint16(r8>>4)<<8 | uint16(g8>>4)<<4 | uint16(b8>>4)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.r += uint64(r8)
+			bk.g += uint64(g8)
+			bk.b += uint64(b8)
+			bk.count++
+		}
+	}
+
+	counts := make([]weightedColor, 0, len(buckets))
+	for _, bk := range buckets {
+		counts = append(counts, weightedColor{
+			color: NewColor(uint8(bk.r/bk.count), uint8(bk.g/bk.count), uint8(bk.b/bk.count)),
+			count: float64(bk.count),
+		})
+	}
+	return mergeColors(counts, n)
+}
+
+var (
+	svgColorAttr = regexp.MustCompile(`(?i)(?:fill|stop-color)\s*[=:]\s*["']?\s*(#[0-9a-f]{3,6}|rgb\([^)]*\)|[a-z]+)`)
+	svgRGB       = regexp.MustCompile(`(?i)rgb\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*\)`)
+)
+
+// Именованные цвета, которые встречаются в наших SVG
+var svgNamedColors = map[string]Color{
+	"black":  NewColor(0, 0, 0),
+	"white":  NewColor(255, 255, 255),
+	"red":    NewColor(255, 0, 0),
+	"green":  NewColor(0, 128, 0),
+	"blue":   NewColor(0, 0, 255),
+	"yellow": NewColor(255, 255, 0),
+	"gray":   NewColor(128, 128, 128),
+	"grey":   NewColor(128, 128, 128),
+	"orange": NewColor(255, 165, 0),
+	"purple": NewColor(128, 0, 128),
+}
+
+// FromSVG извлекает до n цветов заливки SVG. Вес цвета — частота его упоминания в документе.
+func FromSVG(data []byte, n int) []Swatch {
+	counts := make(map[string]*weightedColor)
+	var order []string
+
+	for _, match := range svgColorAttr.FindAllStringSubmatch(string(data), -1) {
+		value := strings.ToLower(match[1])
+
+		var c Color
+		var err error
+		switch {
+		case strings.HasPrefix(value, "#"):
+			c, err = ParseHex(value)
+			if err != nil {
+				continue
+			}
+		case strings.HasPrefix(value, "rgb("):
+			parts := svgRGB.FindStringSubmatch(value)
+			if parts == nil {
+				continue
+			}
+			r, _ := strconv.Atoi(parts[1])
+			g, _ := strconv.Atoi(parts[2])
+			b, _ := strconv.Atoi(parts[3])
+			c = NewColor(clamp8(r), clamp8(g), clamp8(b))
+		default:
+			named, ok := svgNamedColors[value]
+			if !ok {
+				// none, currentColor, url(#...) и прочее — не цвет
+				continue
+			}
+			c = named
+		}
+
+		hex := c.Hex()
+		if wc, ok := counts[hex]; ok {
+			wc.count++
+			continue
+		}
+		counts[hex] = &weightedColor{color: c, count: 1}
+		order = append(order, hex)
+	}
+
+	colors := make([]weightedColor, 0, len(order))
+	for _, hex := range order {
+		colors = append(colors, *counts[hex])
+	}
+	return mergeColors(colors, n)
+}
+
+type weightedColor struct {
+	color Color
+	count float64
+}
+
+// mergeColors сливает близкие цвета и возвращает n самых весомых с нормированным весом
+func mergeColors(colors []weightedColor, n int) []Swatch {
+	sort.SliceStable(colors, func(i, j int) bool {
+		return colors[i].count > colors[j].count
+	})
+
+	var total float64
+	var merged []weightedColor
+	for _, wc := range colors {
+		total += wc.count
+		found := false
+		for i := range merged {
+			if DeltaE76(merged[i].color.Lab, wc.color.Lab) < mergeDistance {
+				merged[i].count += wc.count
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, wc)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].count > merged[j].count
+	})
+	if len(merged) > n {
+		merged = merged[:n]
+	}
+
+	swatches := make([]Swatch, 0, len(merged))
+	for _, wc := range merged {
+		swatches = append(swatches, Swatch{Color: wc.color, Weight: wc.count / total})
+	}
+	return swatches
+}
+
+func clamp8(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,134 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/nfnt/resize"
+)
+
+// Hash — 128-битный перцептивный отпечаток изображения: pHash (DCT) и dHash (градиенты)
+type Hash struct {
+	PHash uint64
+	DHash uint64
+}
+
+// Distance — расстояние Хэмминга между отпечатками (0..128)
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(h.PHash^other.PHash) + bits.OnesCount64(h.DHash^other.DHash)
+}
+
+// Compute считает оба хэша изображения
+func Compute(img image.Image) Hash {
+	return Hash{PHash: PHash(img), DHash: DHash(img)}
+}
+
+// grayscale уменьшает изображение до w×h и возвращает яркость пикселей построчно.
+// Прозрачные пиксели считаются белыми, как они выглядят на белом холсте.
+func grayscale(img image.Image, w, h int) [][]float64 {
+	small := resize.Resize(uint(w), uint(h), img, resize.Bilinear)
+	bounds := small.Bounds()
+
+	pixels := make([][]float64, h)
+	for y := 0; y < h; y++ {
+		pixels[y] = make([]float64, w)
+		for x := 0; x < w; x++ {
+			r, g, b, a := small.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// RGBA() возвращает компоненты, умноженные на альфу: добавляем белый фон
+			bg := 0xffff - a
+			gray := color.GrayModel.Convert(color.RGBA64{
+				R: uint16(r + bg), G: uint16(g + bg), B: uint16(b + bg), A: 0xffff,
+			}).(color.Gray)
+			pixels[y][x] = float64(gray.Y)
+		}
+	}
+	return pixels
+}
+
+// DHash сравнивает яркость соседних пикселей в уменьшенном до 9×8 изображении
+func DHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y][x] < pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+const dctSize = 32
+
+// PHash берёт низкие частоты DCT уменьшенного до 32×32 изображения и сравнивает их с медианой
+func PHash(img image.Image) uint64 {
+	pixels := grayscale(img, dctSize, dctSize)
+	coeffs := dct2D(pixels)
+
+	lows := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			lows = append(lows, coeffs[y][x])
+		}
+	}
+
+	// Постоянная составляющая [0][0] сильно отличается от остальных и искажает медиану
+	sorted := append([]float64(nil), lows[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, c := range lows {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+var dctCos = func() [dctSize][dctSize]float64 {
+	var table [dctSize][dctSize]float64
+	for k := 0; k < dctSize; k++ {
+		for n := 0; n < dctSize; n++ {
+			table[k][n] = math.Cos(math.Pi / dctSize * (float64(n) + 0.5) * float64(k))
+		}
+	}
+	return table
+}()
+
+// dct2D — двумерное DCT-II: сначала по строкам, затем по столбцам
+func dct2D(pixels [][]float64) [][]float64 {
+	rows := make([][]float64, dctSize)
+	for y := 0; y < dctSize; y++ {
+		rows[y] = make([]float64, dctSize)
+		for k := 0; k < dctSize; k++ {
+			var sum float64
+			for n := 0; n < dctSize; n++ {
+				sum += pixels[y][n] * dctCos[k][n]
+			}
+			rows[y][k] = sum
+		}
+	}
+
+	result := make([][]float64, dctSize)
+	for k := 0; k < dctSize; k++ {
+		result[k] = make([]float64, dctSize)
+	}
+	for x := 0; x < dctSize; x++ {
+		for k := 0; k < dctSize; k++ {
+			var sum float64
+			for n := 0; n < dctSize; n++ {
+				sum += rows[n][x] * dctCos[k][n]
+			}
+			result[k][x] = sum
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"database/sql"
+	"time"
+)
+
+type AnalyticsRepository struct {
+	db *sql.DB
+}
+
+func NewAnalyticsRepository(db *sql.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+func (r *AnalyticsRepository) RecordSearch(query, family, uuidHash string, resultCount int) error {
+	_, err := r.db.Exec(`
+		INSERT INTO search_events (query, family, result_count, uuid_hash)
+		VALUES ($1, $2, $3, $4)`, query, family, resultCount, uuidHash)
+	return err
+}
+
+// RecordClick отмечает последний поиск пользователя за окно window как приведший к использованию изображения
+func (r *AnalyticsRepository) RecordClick(uuidHash string, imageID int, window time.Duration) error {
+	_, err := r.db.Exec(`
+		UPDATE search_events SET clicked_image_id = $2, clicked_at = now()
+		WHERE id = (
+			SELECT id FROM search_events
+			WHERE uuid_hash = $1 AND clicked_at IS NULL AND result_count > 0
+			  AND created_at >= now() - $3 * INTERVAL '1 second'
+			ORDER BY created_at DESC
+			LIMIT 1
+		)`, uuidHash, imageID, window.Seconds())
+	return err
+}
+
+const searchStatsQuery = `
+	SELECT query, family,
+		COUNT(*) AS searches,
+		COUNT(DISTINCT NULLIF(uuid_hash, '')) AS users,
+		AVG(result_count)::float8 AS avg_results,
+		COUNT(clicked_at) AS clicks,
+		COUNT(clicked_at)::float8 / COUNT(*) AS ctr
+	FROM search_events
+	WHERE created_at >= $1 AND created_at < $2`
+
+// GetTopQueries возвращает самые частые запросы за период
+func (r *AnalyticsRepository) GetTopQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return r.querySearchStats(searchStatsQuery+`
+	GROUP BY query, family
+	ORDER BY searches DESC, query
+	LIMIT $3`, from, to, limit)
+}
+
+// GetZeroResultQueries возвращает самые частые запросы, не давшие ни одного результата
+func (r *AnalyticsRepository) GetZeroResultQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return r.querySearchStats(searchStatsQuery+`
+	AND result_count = 0
+	GROUP BY query, family
+	ORDER BY searches DESC, query
+	LIMIT $3`, from, to, limit)
+}
+
+// GetClickThrough возвращает запросы с результатами, упорядоченные по доле поисков,
+// после которых пользователь использовал изображение (от худших к лучшим)
+func (r *AnalyticsRepository) GetClickThrough(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return r.querySearchStats(searchStatsQuery+`
+	AND result_count > 0
+	GROUP BY query, family
+	ORDER BY ctr ASC, searches DESC, query
+	LIMIT $3`, from, to, limit)
+}
+
+func (r *AnalyticsRepository) querySearchStats(query string, args ...interface{}) ([]model.SearchQueryStat, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []model.SearchQueryStat{}
+	for rows.Next() {
+		var st model.SearchQueryStat
+		err := rows.Scan(&st.Query, &st.Family, &st.Searches, &st.Users, &st.AvgResults, &st.Clicks, &st.ClickThroughRate)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
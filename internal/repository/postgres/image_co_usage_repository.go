@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"fmt"
+)
+
+// RefreshCoUsage пересчитывает материализованное представление совместного использования
+func (r *ImageRepository) RefreshCoUsage() error {
+	_, err := r.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY image_co_usage`)
+	return err
+}
+
+// GetCoUsedImages возвращает видимые изображения из других семейств, которые чаще всего используют
+// в одной сессии с imageID. Пустой family означает все семейства, кроме семейства imageID.
+func (r *ImageRepository) GetCoUsedImages(imageID int, family string, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	query := `
+	SELECT ` + imageColumns + `
+	FROM image_co_usage c
+	JOIN images i ON i.id = c.other_id
+	JOIN subgroups s ON i.subgroup_id = s.id
+	JOIN groups g ON s.group_id = g.id
+	JOIN families f ON g.family_id = f.id
+	WHERE c.image_id = $1
+	AND f.id != (
+		SELECT sg.family_id FROM images si
+		JOIN subgroups ss ON si.subgroup_id = ss.id
+		JOIN groups sg ON ss.group_id = sg.id
+		WHERE si.id = $1
+	)
+	AND ($2 = '' OR f.name = $2)
+	AND ` + visibleCondition
+
+	query, args := appendImageFilter(query, []interface{}{imageID, family}, filter)
+	args = append(args, limit)
+	query += fmt.Sprintf(`
+	ORDER BY c.score DESC, c.sessions DESC, i.id
+	LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images, err := scanImages(rows)
+	if images == nil && err == nil {
+		images = []model.Image{}
+	}
+	return images, err
+}
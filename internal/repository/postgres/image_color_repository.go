@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// visibleCondition — изображения, которые показываются в поиске и подборках:
+// без широких вариантов (Wide) и из текстур только цветные. Ожидает алиасы s и f.
+const visibleCondition = `s.name NOT ILIKE '%Wide%' AND (f.name != 'Textures' OR s.name = 'Color')`
+
+// GetImagesWithPalettes возвращает видимые изображения вместе с их палитрами.
+// Пустые keyword и family не ограничивают выборку.
+func (r *ImageRepository) GetImagesWithPalettes(keyword, family string, filter model.ImageFilter) ([]model.Image, error) {
+	query := `
+	SELECT ` + imageColumns + `
+	FROM images i
+	JOIN subgroups s ON i.subgroup_id = s.id
+	JOIN groups g ON s.group_id = g.id
+	JOIN families f ON g.family_id = f.id
+	WHERE ($1 = '' OR i.name ILIKE f.name || '_%' || $1 || '%' OR i.title ILIKE '%' || $1 || '%'
+		OR EXISTS (SELECT 1 FROM unnest(i.meta_tags) AS tag WHERE tag ILIKE '%' || $1 || '%'))
+	AND ($2 = '' OR f.name = $2)
+	AND ` + visibleCondition + `
+	AND EXISTS (SELECT 1 FROM image_colors c WHERE c.image_id = i.id)`
+
+	query, args := appendImageFilter(query, []interface{}{keyword, family}, filter)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error executing query: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	images, err := scanImages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return images, nil
+	}
+
+	ids := make([]int64, len(images))
+	byID := make(map[int]*model.Image, len(images))
+	for i := range images {
+		ids[i] = int64(images[i].ID)
+		byID[images[i].ID] = &images[i]
+	}
+
+	colorRows, err := r.db.Query(`
+		SELECT image_id, hex, l, a, b, weight
+		FROM image_colors
+		WHERE image_id = ANY($1)
+		ORDER BY image_id, position`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer colorRows.Close()
+
+	for colorRows.Next() {
+		var imageID int
+		var c model.ImageColor
+		if err := colorRows.Scan(&imageID, &c.Hex, &c.L, &c.A, &c.B, &c.Weight); err != nil {
+			return nil, err
+		}
+		if img, ok := byID[imageID]; ok {
+			img.Palette = append(img.Palette, c)
+		}
+	}
+
+	return images, colorRows.Err()
+}
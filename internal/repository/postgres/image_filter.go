@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"fmt"
+)
+
+// appendImageFilter дописывает к WHERE-части запроса условия фильтра и возвращает
+// обновлённые запрос и аргументы. Ожидает алиас i для таблицы images.
+func appendImageFilter(query string, args []interface{}, f model.ImageFilter) (string, []interface{}) {
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		query += fmt.Sprintf("\n\tAND "+condition, len(args))
+	}
+
+	if f.MinWidth > 0 {
+		add("i.width >= $%d", f.MinWidth)
+	}
+	if f.MaxWidth > 0 {
+		add("i.width <= $%d", f.MaxWidth)
+	}
+	if f.MinHeight > 0 {
+		add("i.height >= $%d", f.MinHeight)
+	}
+	if f.MaxHeight > 0 {
+		add("i.height <= $%d", f.MaxHeight)
+	}
+	if f.MinAspect > 0 {
+		add("i.aspect_ratio >= $%d", f.MinAspect)
+	}
+	if f.MaxAspect > 0 {
+		add("i.aspect_ratio <= $%d", f.MaxAspect)
+	}
+	if f.BitDepth > 0 {
+		add("i.bit_depth = $%d", f.BitDepth)
+	}
+	if f.HasAlpha != nil {
+		add("i.has_alpha = $%d", *f.HasAlpha)
+	}
+
+	switch f.Orientation {
+	case model.OrientationLandscape:
+		query += "\n\tAND i.width > i.height"
+	case model.OrientationPortrait:
+		query += "\n\tAND i.width < i.height"
+	case model.OrientationSquare:
+		query += "\n\tAND i.width = i.height AND i.width > 0"
+	}
+
+	return query, args
+}
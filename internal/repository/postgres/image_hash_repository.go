@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+)
+
+// GetImageHashes возвращает перцептивные хэши всех изображений, для которых они посчитаны
+func (r *ImageRepository) GetImageHashes() ([]model.ImageHash, error) {
+	rows, err := r.db.Query(`
+		SELECT i.id, f.name, (` + visibleCondition + `), i.phash, i.dhash
+		FROM images i
+		JOIN subgroups s ON i.subgroup_id = s.id
+		JOIN groups g ON s.group_id = g.id
+		JOIN families f ON g.family_id = f.id
+		WHERE i.phash IS NOT NULL AND i.dhash IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []model.ImageHash
+	for rows.Next() {
+		var h model.ImageHash
+		var pHash, dHash int64
+		if err := rows.Scan(&h.ImageID, &h.Family, &h.Visible, &pHash, &dHash); err != nil {
+			return nil, err
+		}
+		h.PHash, h.DHash = uint64(pHash), uint64(dHash)
+		hashes = append(hashes, h)
+	}
+
+	return hashes, rows.Err()
+}
@@ -3,8 +3,11 @@ package postgres
 import (
 	"HorizonBackend/internal/model"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -17,7 +20,56 @@ func NewImageRepository(db *sql.DB) *ImageRepository {
 	return &ImageRepository{db: db}
 }
 
-func (r *ImageRepository) GetImagesByFamilyGroupSubgroup(family, group, subgroup string) ([]model.Image, error) {
+// imageColumns — колонки изображения в порядке, который ожидает scanImage.
+// Миниатюры разных размеров собираются в один JSON-объект по имени.
+const imageColumns = `i.id, i.subgroup_id, i.name, i.file_path, i.thumb_path, i.usage_count, i.meta_tags,
+	i.title, i.description, i.author, i.license,
+	i.width, i.height, i.aspect_ratio, i.bit_depth, i.has_alpha,
+	COALESCE(i.format, ''), i.animated, i.version, i.updated_at,
+	(SELECT json_object_agg(r.name, json_build_object('path', r.path, 'width', r.width, 'height', r.height))
+	 FROM image_renditions r WHERE r.image_id = i.id) AS thumbnails`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanImage читает колонки imageColumns в img; extra — дополнительные колонки после них
+func scanImage(row rowScanner, img *model.Image, extra ...interface{}) error {
+	var thumbnails []byte
+	dest := []interface{}{&img.ID, &img.SubgroupID, &img.Name, &img.FilePath, &img.ThumbPath, &img.UsageCount, pq.Array(&img.MetaTags),
+		&img.Title, &img.Description, &img.Author, &img.License,
+		&img.Width, &img.Height, &img.AspectRatio, &img.BitDepth, &img.HasAlpha,
+		&img.Format, &img.Animated, &img.Version, &img.UpdatedAt, &thumbnails}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if thumbnails != nil {
+		if err := json.Unmarshal(thumbnails, &img.Thumbnails); err != nil {
+			return err
+		}
+	}
+	img.Orientation = model.OrientationOf(img.Width, img.Height)
+	return nil
+}
+
+func scanImages(rows *sql.Rows) ([]model.Image, error) {
+	var images []model.Image
+	for rows.Next() {
+		var img model.Image
+		if err := scanImage(rows, &img); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func (r *ImageRepository) GetImagesByFamilyGroupSubgroup(family, group, subgroup string, filter model.ImageFilter) ([]model.Image, error) {
 	// Получение ID подгруппы по имени семейства, группы и подгруппы
 	var subgroupID int
 	err := r.db.QueryRow(`
@@ -30,45 +82,51 @@ func (r *ImageRepository) GetImagesByFamilyGroupSubgroup(family, group, subgroup
 		return nil, err
 	}
 
-	rows, err := r.db.Query(`
-		SELECT i.id, i.subgroup_id, i.name, i.file_path, i.thumb_path, i.usage_count, i.meta_tags 
+	query, args := appendImageFilter(`
+		SELECT `+imageColumns+`
 		FROM "images" i
 		JOIN "subgroups" sg ON i.subgroup_id = sg.id 
-		WHERE sg.id = $1`, subgroupID)
+		WHERE sg.id = $1`, []interface{}{subgroupID}, filter)
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var images []model.Image
-	for rows.Next() {
-		var img model.Image
-		err := rows.Scan(&img.ID, &img.SubgroupID, &img.Name, &img.FilePath, &img.ThumbPath, &img.UsageCount, pq.Array(&img.MetaTags))
-		if err != nil {
-			return nil, err
-		}
-		images = append(images, img)
+	return scanImages(rows)
+}
+
+// GetImagesByIDs возвращает изображения в порядке переданных ID; несуществующие ID пропускаются
+func (r *ImageRepository) GetImagesByIDs(ids []int) ([]model.Image, error) {
+	if len(ids) == 0 {
+		return []model.Image{}, nil
 	}
 
-	if err = rows.Err(); err != nil {
+	rows, err := r.db.Query(`
+		SELECT `+imageColumns+`
+		FROM images i
+		JOIN unnest($1::int[]) WITH ORDINALITY AS ids(id, ord) ON ids.id = i.id
+		ORDER BY ids.ord`, pq.Array(ids))
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return images, nil
-}
-
-func (r *ImageRepository) IncreaseUsageCount(thumbPath string) error {
-	_, err := r.db.Exec("UPDATE Images SET usage_count = usage_count + 1 WHERE thumb_path = $1", thumbPath)
-	return err
+	images, err := scanImages(rows)
+	if images == nil && err == nil {
+		images = []model.Image{}
+	}
+	return images, err
 }
 
 func (r *ImageRepository) GetImageByID(imageID int) (model.Image, error) {
 	var img model.Image
-	err := r.db.QueryRow(`SELECT id, subgroup_id, name, file_path, usage_count, meta_tags FROM "images" WHERE id = $1`, imageID).Scan(&img.ID, &img.SubgroupID, &img.Name, &img.FilePath, &img.UsageCount, pq.Array(&img.MetaTags))
+	err := scanImage(r.db.QueryRow(`SELECT `+imageColumns+` FROM "images" i WHERE i.id = $1`, imageID), &img)
 	return img, err
 }
 
-func (r *ImageRepository) SearchImagesByKeywordAndFamily(keyword, family string) ([]model.Image, error) {
+func (r *ImageRepository) SearchImagesByKeywordAndFamily(keyword, family string, filter model.ImageFilter) ([]model.Image, error) {
 	keyword = strings.TrimSpace(keyword)
 	if keyword == "" {
 		return []model.Image{}, nil
@@ -76,41 +134,34 @@ func (r *ImageRepository) SearchImagesByKeywordAndFamily(keyword, family string)
 	keyword = "%" + keyword + "%"
 
 	query := `
-	SELECT i.id, i.subgroup_id, i.name, i.file_path, i.thumb_path, i.usage_count, i.meta_tags
+	SELECT ` + imageColumns + `
 	FROM images i
 	JOIN subgroups s ON i.subgroup_id = s.id
 	JOIN groups g ON s.group_id = g.id
 	JOIN families f ON g.family_id = f.id
 	WHERE (
 		i.name ILIKE f.name || '_' || $1
+		OR i.title ILIKE $1
 		OR EXISTS (
 			SELECT 1 FROM unnest(i.meta_tags) AS tag WHERE tag ILIKE $1
 		)
 	) AND f.name = $2
 	AND s.name NOT ILIKE '%Wide%'
-	AND (f.name != 'Textures' OR (f.name = 'Textures' AND s.name = 'Color'));
+	AND (f.name != 'Textures' OR (f.name = 'Textures' AND s.name = 'Color'))`
 
-	`
+	query, args := appendImageFilter(query, []interface{}{keyword, family}, filter)
 
-	rows, err := r.db.Query(query, keyword, family)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error executing query: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var images []model.Image
-	for rows.Next() {
-		var img model.Image
-		var metaTags pq.StringArray
-
-		err := rows.Scan(&img.ID, &img.SubgroupID, &img.Name, &img.FilePath, &img.ThumbPath, &img.UsageCount, &metaTags)
-		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			return nil, err
-		}
-		img.MetaTags = []string(metaTags)
-		images = append(images, img)
+	images, err := scanImages(rows)
+	if err != nil {
+		log.Printf("Error scanning row: %v", err)
+		return nil, err
 	}
 
 	return images, nil
@@ -134,14 +185,14 @@ func (r *ImageRepository) FindImageByNumber(family, group, subgroup, imageNumber
 
 	imageNamePattern := family + "_" + group + "_" + subgroup + "_%" + imageNumber
 
-	query := `SELECT id, subgroup_id, name, file_path, thumb_path, usage_count, meta_tags 
-              FROM images 
-              WHERE subgroup_id = $1 AND name LIKE $2`
+	query := `SELECT ` + imageColumns + `
+              FROM images i
+              WHERE i.subgroup_id = $1 AND i.name LIKE $2`
 
 	row := r.db.QueryRow(query, subgroupID, imageNamePattern)
 
 	image := &model.Image{}
-	err = row.Scan(&image.ID, &image.SubgroupID, &image.Name, &image.FilePath, &image.ThumbPath, &image.UsageCount, pq.Array(&image.MetaTags))
+	err = scanImage(row, image)
 
 	if err != nil {
 		return nil, err
@@ -149,39 +200,46 @@ func (r *ImageRepository) FindImageByNumber(family, group, subgroup, imageNumber
 	return image, nil
 }
 
-func (r *ImageRepository) GetLeastUsedImages(family string, limit int) ([]model.Image, error) {
-	const query = `
-		SELECT i.id, i.subgroup_id, i.name, i.file_path, i.thumb_path, i.usage_count, i.meta_tags 
+// GetLeastUsedCandidates возвращает до limit видимых изображений семейства по возрастанию usage_count.
+// Изображения, которые лицензия licenseUUID уже использовала или которые ей показывали начиная
+// с shownSince, исключаются. Равные по usage_count кандидаты упорядочиваются псевдослучайно,
+// но стабильно для seed.
+func (r *ImageRepository) GetLeastUsedCandidates(family, licenseUUID, seed string, shownSince time.Time, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	query := `
+		SELECT ` + imageColumns + `
 		FROM "images" i
 		JOIN "subgroups" sg ON i.subgroup_id = sg.id 
 		JOIN "groups" g ON sg.group_id = g.id 
 		JOIN "families" f ON g.family_id = f.id 
 		WHERE f.name = $1
 		   AND sg.name NOT ILIKE '%Wide%'  -- проверка, что имя subgroup не содержит слово 'Wide'
-		   AND (f.name != 'Textures' OR (f.name = 'Textures' AND sg.name = 'Color')) 
-		ORDER BY i.usage_count ASC 
-		LIMIT $2;
-    `
-	rows, err := r.db.Query(query, family, limit)
+		   AND (f.name != 'Textures' OR (f.name = 'Textures' AND sg.name = 'Color'))
+		   AND ($2 = '' OR NOT EXISTS (SELECT 1 FROM usage_events e WHERE e.image_id = i.id AND e.license_uuid = $2))
+		   AND ($2 = '' OR NOT EXISTS (SELECT 1 FROM suggestion_impressions si
+		                               WHERE si.image_id = i.id AND si.license_uuid = $2 AND si.shown_at >= $3))`
+
+	query, args := appendImageFilter(query, []interface{}{family, licenseUUID, shownSince, seed}, filter)
+	args = append(args, limit)
+	query += fmt.Sprintf(`
+		ORDER BY i.usage_count ASC, md5($4 || i.id::text)
+		LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error querying the database: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var images []model.Image
-	for rows.Next() {
-		var img model.Image
-		err := rows.Scan(&img.ID, &img.SubgroupID, &img.Name, &img.FilePath, &img.ThumbPath, &img.UsageCount, pq.Array(&img.MetaTags))
-		if err != nil {
-			return nil, err
-		}
-		images = append(images, img)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+	return scanImages(rows)
+}
 
-	return images, nil
+// RecordImpressions запоминает, что изображения были показаны пользователю в подборке
+func (r *ImageRepository) RecordImpressions(licenseUUID string, imageIDs []int) error {
+	_, err := r.db.Exec(`
+		INSERT INTO suggestion_impressions (license_uuid, image_id, shown_at)
+		SELECT $1, unnest($2::int[]), now()
+		ON CONFLICT (license_uuid, image_id) DO UPDATE SET shown_at = excluded.shown_at`,
+		licenseUUID, pq.Array(imageIDs))
+	return err
 }
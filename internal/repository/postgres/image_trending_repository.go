@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"fmt"
+)
+
+// RefreshTrending пересчитывает материализованное представление популярности
+func (r *ImageRepository) RefreshTrending() error {
+	_, err := r.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY image_trending`)
+	return err
+}
+
+// GetTrendingImages возвращает видимые изображения по убыванию популярности за окно windowDays.
+// Пустой family означает все семейства.
+func (r *ImageRepository) GetTrendingImages(family string, windowDays, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	query := `
+	SELECT ` + imageColumns + `
+	FROM image_trending t
+	JOIN images i ON i.id = t.image_id
+	JOIN subgroups s ON i.subgroup_id = s.id
+	JOIN groups g ON s.group_id = g.id
+	JOIN families f ON g.family_id = f.id
+	WHERE t.window_days = $1
+	AND ($2 = '' OR f.name = $2)
+	AND ` + visibleCondition
+
+	query, args := appendImageFilter(query, []interface{}{windowDays, family}, filter)
+	args = append(args, limit)
+	query += fmt.Sprintf(`
+	ORDER BY t.score DESC, i.id
+	LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images, err := scanImages(rows)
+	if images == nil && err == nil {
+		images = []model.Image{}
+	}
+	return images, err
+}
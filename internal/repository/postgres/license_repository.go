@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+)
+
+type LicenseRepository struct {
+	db *sql.DB
+}
+
+func NewLicenseRepository(db *sql.DB) *LicenseRepository {
+	return &LicenseRepository{db: db}
+}
+
+// SaveGrant запоминает, что лицензия прошла проверку и действует до expiresAt
+func (r *LicenseRepository) SaveGrant(licenseUUID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO license_grants (license_uuid, granted_at, expires_at)
+		VALUES ($1, now(), $2)
+		ON CONFLICT (license_uuid)
+		DO UPDATE SET granted_at = now(), expires_at = GREATEST(license_grants.expires_at, EXCLUDED.expires_at)`,
+		licenseUUID, expiresAt)
+	return err
+}
+
+// GetGrantExpiry возвращает срок действия лицензии (нулевое время, если лицензия не проверялась)
+func (r *LicenseRepository) GetGrantExpiry(licenseUUID string) (time.Time, error) {
+	var expiresAt time.Time
+	err := r.db.QueryRow(`SELECT expires_at FROM license_grants WHERE license_uuid = $1`, licenseUUID).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return expiresAt, err
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"database/sql"
+)
+
+type SuggestRepository struct {
+	db *sql.DB
+}
+
+func NewSuggestRepository(db *sql.DB) *SuggestRepository {
+	return &SuggestRepository{db: db}
+}
+
+// GetSuggestionSources возвращает термины для индекса автодополнения: теги, названия
+// семейств, групп и подгрупп (с числом видимых изображений) и популярные запросы.
+func (r *SuggestRepository) GetSuggestionSources() ([]model.SuggestionSource, error) {
+	query := `
+	WITH visible AS (
+		SELECT i.meta_tags, f.name AS family, g.name AS grp, s.name AS subgroup
+		FROM images i
+		JOIN subgroups s ON i.subgroup_id = s.id
+		JOIN groups g ON s.group_id = g.id
+		JOIN families f ON g.family_id = f.id
+		WHERE ` + visibleCondition + `
+	)
+	SELECT tag, '` + model.SuggestionTag + `', family, COUNT(*) FROM visible, unnest(meta_tags) AS tag GROUP BY tag, family
+	UNION ALL
+	SELECT family, '` + model.SuggestionFamily + `', family, COUNT(*) FROM visible GROUP BY family
+	UNION ALL
+	SELECT grp, '` + model.SuggestionGroup + `', family, COUNT(*) FROM visible GROUP BY grp, family
+	UNION ALL
+	SELECT subgroup, '` + model.SuggestionSubgroup + `', family, COUNT(*) FROM visible GROUP BY subgroup, family
+	UNION ALL
+	SELECT query, '` + model.SuggestionQuery + `', family, hits FROM popular_queries`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []model.SuggestionSource
+	for rows.Next() {
+		var src model.SuggestionSource
+		if err := rows.Scan(&src.Text, &src.Type, &src.Family, &src.Hits); err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+
+	return sources, rows.Err()
+}
+
+// RecordQuery увеличивает счётчик поискового запроса, давшего результаты
+func (r *SuggestRepository) RecordQuery(query, family string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO popular_queries (query, family, hits, last_seen)
+		VALUES ($1, $2, 1, now())
+		ON CONFLICT (query, family)
+		DO UPDATE SET hits = popular_queries.hits + 1, last_seen = now()`, query, family)
+	return err
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetHistoryClearedAt возвращает, когда лицензия очищала историю (нулевое время, если не очищала)
+func (r *UsageRepository) GetHistoryClearedAt(licenseUUID string) (time.Time, error) {
+	var clearedAt time.Time
+	err := r.db.QueryRow(`SELECT cleared_at FROM usage_history_resets WHERE license_uuid = $1`, licenseUUID).Scan(&clearedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return clearedAt, err
+}
+
+// ClearHistory скрывает из истории все использования лицензии до текущего момента
+func (r *UsageRepository) ClearHistory(licenseUUID string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO usage_history_resets (license_uuid, cleared_at)
+		VALUES ($1, now())
+		ON CONFLICT (license_uuid) DO UPDATE SET cleared_at = now()`, licenseUUID)
+	return err
+}
+
+// GetRecentImageIDs возвращает до limit разных изображений, использованных лицензией после since,
+// от последнего использования к более ранним
+func (r *UsageRepository) GetRecentImageIDs(licenseUUID string, since time.Time, limit int) ([]int, error) {
+	rows, err := r.db.Query(`
+		SELECT image_id FROM usage_events
+		WHERE license_uuid = $1 AND created_at > $2
+		GROUP BY image_id
+		ORDER BY MAX(created_at) DESC, image_id
+		LIMIT $3`, licenseUUID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
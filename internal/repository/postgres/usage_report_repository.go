@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"fmt"
+	"time"
+)
+
+// usageReportColumns — колонки группировки для каждого уровня отчёта
+var usageReportColumns = map[string][]string{
+	model.UsageReportFamily:   {"f.name"},
+	model.UsageReportGroup:    {"f.name", "g.name"},
+	model.UsageReportSubgroup: {"f.name", "g.name", "s.name"},
+	model.UsageReportImage:    {"f.name", "g.name", "s.name", "i.id", "COALESCE(i.file_path, '')"},
+}
+
+// GetUsageReport агрегирует использование за [from, to) на уровне level. Изображения без
+// использований в периоде входят в отчёт с нулями. Пустой family — все семейства.
+// Сначала идут наименее используемые.
+func (r *UsageRepository) GetUsageReport(level, family string, from, to time.Time) ([]model.UsageReportRow, error) {
+	columns, ok := usageReportColumns[level]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage report level %q", level)
+	}
+
+	groupBy := ""
+	for i, c := range columns {
+		if i > 0 {
+			groupBy += ", "
+		}
+		groupBy += c
+	}
+
+	query := `
+	SELECT ` + groupBy + `,
+		COUNT(DISTINCT i.id),
+		COUNT(DISTINCT e.image_id),
+		COUNT(e.id),
+		COUNT(e.id) FILTER (WHERE e.action = '` + model.UsageActionInsert + `'),
+		COUNT(e.id) FILTER (WHERE e.action = '` + model.UsageActionReplace + `'),
+		COUNT(DISTINCT NULLIF(e.license_uuid, ''))
+	FROM images i
+	JOIN subgroups s ON i.subgroup_id = s.id
+	JOIN groups g ON s.group_id = g.id
+	JOIN families f ON g.family_id = f.id
+	LEFT JOIN usage_events e ON e.image_id = i.id AND e.created_at >= $1 AND e.created_at < $2
+	WHERE ($3 = '' OR f.name = $3)
+	GROUP BY ` + groupBy + `
+	ORDER BY COUNT(e.id), ` + groupBy
+
+	rows, err := r.db.Query(query, from, to, family)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []model.UsageReportRow{}
+	for rows.Next() {
+		var row model.UsageReportRow
+		dest := []interface{}{&row.Family}
+		switch level {
+		case model.UsageReportGroup:
+			dest = append(dest, &row.Group)
+		case model.UsageReportSubgroup:
+			dest = append(dest, &row.Group, &row.Subgroup)
+		case model.UsageReportImage:
+			dest = append(dest, &row.Group, &row.Subgroup, &row.ImageID, &row.FilePath)
+		}
+		dest = append(dest, &row.Images, &row.UsedImages, &row.Events, &row.Inserts, &row.Replaces, &row.Licenses)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+
+	return report, rows.Err()
+}
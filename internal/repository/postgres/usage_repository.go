@@ -0,0 +1,247 @@
+package postgres
+
+import (
+	"HorizonBackend/internal/model"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type UsageRepository struct {
+	db *sql.DB
+}
+
+func NewUsageRepository(db *sql.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// GetImageIDByThumbPath возвращает ID изображения по пути миниатюры (0, если путь не найден).
+// Подходит и путь самого файла: раньше миниатюрой SVG-рамок служил исходный SVG.
+func (r *UsageRepository) GetImageIDByThumbPath(thumbPath string) (int, error) {
+	var imageID int
+	err := r.db.QueryRow(`
+		SELECT id FROM images WHERE thumb_path = $1 OR file_path = $1
+		ORDER BY thumb_path = $1 DESC, id LIMIT 1`, thumbPath).Scan(&imageID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return imageID, err
+}
+
+// GetUsageCounts возвращает usage_count существующих изображений из ids
+func (r *UsageRepository) GetUsageCounts(ids []int) (map[int]int, error) {
+	rows, err := r.db.Query(`SELECT id, usage_count FROM images WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int, len(ids))
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+// InsertUsageEvents записывает накопленные события одним запросом: каждое PendingUsage
+// разворачивается в Count строк со временем последнего использования, чтобы недавние и
+// использованные после очистки истории изображения не уходили назад. События удалённых
+// за это время изображений пропускаются.
+// Возвращает число записанных событий.
+func (r *UsageRepository) InsertUsageEvents(events []model.PendingUsage) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	imageIDs := make([]int64, len(events))
+	uuids := make([]string, len(events))
+	actions := make([]string, len(events))
+	counts := make([]int64, len(events))
+	times := make([]string, len(events))
+	for i, e := range events {
+		imageIDs[i] = int64(e.ImageID)
+		uuids[i] = e.LicenseUUID
+		actions[i] = e.Action
+		counts[i] = int64(e.Count)
+		times[i] = e.LastSeen.UTC().Format(time.RFC3339Nano)
+	}
+
+	res, err := r.db.Exec(`
+		INSERT INTO usage_events (image_id, license_uuid, action, created_at)
+		SELECT e.image_id, e.license_uuid, e.action, e.created_at
+		FROM unnest($1::int[], $2::text[], $3::text[], $4::int[], $5::timestamptz[])
+			AS e(image_id, license_uuid, action, cnt, created_at)
+		CROSS JOIN LATERAL generate_series(1, e.cnt)
+		WHERE EXISTS (SELECT 1 FROM images i WHERE i.id = e.image_id)`,
+		pq.Array(imageIDs), pq.Array(uuids), pq.Array(actions), pq.Array(counts), pq.Array(times))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// GetUsedSince возвращает, какие из ids лицензия использовала начиная с since
+func (r *UsageRepository) GetUsedSince(licenseUUID string, ids []int, since time.Time) (map[int]bool, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT image_id FROM usage_events
+		WHERE license_uuid = $1 AND image_id = ANY($2) AND created_at >= $3`,
+		licenseUUID, pq.Array(ids), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	used := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		used[id] = true
+	}
+	return used, rows.Err()
+}
+
+// usageSpikeQuery сравнивает число событий за окно [$1, $2) со средним за такие же окна
+// в базовом периоде [$3, $1). Параметры: $4 — число окон в базовом периоде, $5 — во сколько раз
+// должно вырасти использование, $6 — минимум событий, $7 — limit.
+const usageSpikeQuery = `
+	WITH recent AS (
+		SELECT %[1]s AS key, COUNT(*) AS events, COUNT(DISTINCT %[2]s) AS spread
+		FROM usage_events
+		WHERE created_at >= $1 AND created_at < $2 %[3]s
+		GROUP BY %[1]s
+	), baseline AS (
+		SELECT %[1]s AS key, COUNT(*)::float8 / $4 AS expected
+		FROM usage_events
+		WHERE created_at >= $3 AND created_at < $1 %[3]s
+		GROUP BY %[1]s
+	)
+	SELECT r.key, r.events, r.spread, COALESCE(b.expected, 0),
+		r.events / GREATEST(COALESCE(b.expected, 0), 1) AS ratio
+	FROM recent r
+	LEFT JOIN baseline b ON b.key = r.key
+	WHERE r.events >= $6 AND r.events >= $5 * GREATEST(COALESCE(b.expected, 0), 1)
+	ORDER BY ratio DESC, r.events DESC
+	LIMIT $7`
+
+func usageSpikeArgs(to time.Time, p model.UsageSpikeParams) []interface{} {
+	from := to.Add(-p.Window)
+	windows := float64(p.Baseline) / float64(p.Window)
+	if windows < 1 {
+		windows = 1
+	}
+	return []interface{}{from, to, from.Add(-p.Baseline), windows, p.Factor, p.MinEvents, p.Limit}
+}
+
+// GetImageUsageSpikes возвращает изображения, использование которых за окно выросло
+// не меньше чем в Factor раз относительно базового периода
+func (r *UsageRepository) GetImageUsageSpikes(to time.Time, p model.UsageSpikeParams) ([]model.ImageUsageSpike, error) {
+	query := `
+	SELECT s.key, i.thumb_path, s.events, s.spread, s.expected, s.ratio
+	FROM (` + fmt.Sprintf(usageSpikeQuery, "image_id", "license_uuid", "") + `) AS s(key, events, spread, expected, ratio)
+	JOIN images i ON i.id = s.key
+	ORDER BY s.ratio DESC, s.events DESC`
+
+	rows, err := r.db.Query(query, usageSpikeArgs(to, p)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spikes := []model.ImageUsageSpike{}
+	for rows.Next() {
+		var spike model.ImageUsageSpike
+		if err := rows.Scan(&spike.ImageID, &spike.ThumbPath, &spike.Events, &spike.Licenses, &spike.Expected, &spike.Ratio); err != nil {
+			return nil, err
+		}
+		spikes = append(spikes, spike)
+	}
+	return spikes, rows.Err()
+}
+
+// GetLicenseUsageSpikes возвращает лицензии, число использований которых за окно выросло
+// не меньше чем в Factor раз относительно базового периода
+func (r *UsageRepository) GetLicenseUsageSpikes(to time.Time, p model.UsageSpikeParams) ([]model.LicenseUsageSpike, error) {
+	rows, err := r.db.Query(fmt.Sprintf(usageSpikeQuery, "license_uuid", "image_id", "AND license_uuid != ''"), usageSpikeArgs(to, p)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spikes := []model.LicenseUsageSpike{}
+	for rows.Next() {
+		var spike model.LicenseUsageSpike
+		if err := rows.Scan(&spike.LicenseUUID, &spike.Events, &spike.Images, &spike.Expected, &spike.Ratio); err != nil {
+			return nil, err
+		}
+		spikes = append(spikes, spike)
+	}
+	return spikes, rows.Err()
+}
+
+func usageEventConditions(f model.UsageEventFilter) (string, []interface{}) {
+	where := "WHERE TRUE"
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		where += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	if f.ImageID > 0 {
+		add("image_id = $%d", f.ImageID)
+	}
+	if f.LicenseUUID != "" {
+		add("license_uuid = $%d", f.LicenseUUID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	return where, args
+}
+
+// GetUsageEvents возвращает события по фильтру (новые первыми) и общее число подходящих событий
+func (r *UsageRepository) GetUsageEvents(f model.UsageEventFilter) ([]model.UsageEvent, int, error) {
+	where, args := usageEventConditions(f)
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM usage_events `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT id, image_id, license_uuid, action, created_at
+		FROM usage_events %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d`, where, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []model.UsageEvent{}
+	for rows.Next() {
+		var e model.UsageEvent
+		if err := rows.Scan(&e.ID, &e.ImageID, &e.LicenseUUID, &e.Action, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+
+	return events, total, rows.Err()
+}
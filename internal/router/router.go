@@ -5,14 +5,18 @@ import (
 	"HorizonBackend/internal/handler"
 	"HorizonBackend/internal/repository/postgres"
 	"HorizonBackend/internal/service"
+	"HorizonBackend/scripts"
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -43,8 +47,8 @@ func setCORSHeaders(handler http.Handler) http.Handler {
 		// Check if the request is from a client
 		if origin := r.Header.Get("Origin"); origin != "" {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-License-UUID")
 		}
 
 		if r.Method == "OPTIONS" {
@@ -77,7 +81,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func checkMiddleware(next http.Handler, handlerInstance *MyHandler) http.Handler {
+func checkMiddleware(next http.Handler, handlerInstance *MyHandler, licenses service.LicenseService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Log the beginning of the middleware check
 		log.Println("checkMiddleware -1: Checking request")
@@ -149,6 +153,8 @@ func checkMiddleware(next http.Handler, handlerInstance *MyHandler) http.Handler
 			if ResponseAllowed(checkResponse) {
 				log.Printf("ResponseAllowed: Request allowed. Response: %+v\n", checkResponse)
 				handlerInstance.SetCheckResult(true)
+				// Использования изображений засчитываются только от проверенных лицензий
+				licenses.Grant(uuid)
 				// Execute the code that comes after the ResponseAllowed() function
 			} else {
 				// If there is no response or other checks did not pass
@@ -166,6 +172,21 @@ func checkMiddleware(next http.Handler, handlerInstance *MyHandler) http.Handler
 	})
 }
 
+// adminMiddleware пропускает только запросы с заголовком Authorization: Bearer <ADMIN_TOKEN>
+func adminMiddleware(cfg *config.Config) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+				log.Printf("adminMiddleware: Rejected admin request %s %s", r.Method, r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func ResponseAllowed(checkResponse handler.CheckResponse) bool {
 	log.Printf("ResponseAllowed: Received a response from the server: %+v\n", checkResponse)
 
@@ -183,13 +204,78 @@ func ResponseAllowed(checkResponse handler.CheckResponse) bool {
 	}
 }
 
-func NewRouter(db *sql.DB, cfg *config.Config) *mux.Router {
+// Папка с изображениями {family}/{group}/{subgroup}/{image}, она же раздаётся по /static/images/
+const imagesFolder = "./static/images/"
+
+// Как часто перестраиваются индексы в памяти (автодополнение, похожие изображения)
+const indexRefreshInterval = 5 * time.Minute
+
+// Как часто пересчитывается популярность изображений
+const trendingRefreshInterval = 10 * time.Minute
+
+// Как часто пересчитывается совместное использование изображений для рекомендаций
+const recommendationRefreshInterval = time.Hour
+
+// NewRouter создаёт роутер и фоновые задачи; renditions — миниатюры для загружаемых через админку
+// изображений. Возвращаемую функцию нужно вызвать при остановке сервера: она записывает в базу
+// накопленные в памяти использования.
+func NewRouter(db *sql.DB, cfg *config.Config, renditions []scripts.Rendition) (*mux.Router, func()) {
 	r := mux.NewRouter()
 
 	// Initialize the repository and service
 	imageRepo := postgres.NewImageRepository(db)
 	imageService := service.NewImageService(imageRepo)
 
+	// Индекс автодополнения строится после загрузки изображений и периодически обновляется
+	suggestService := service.NewSuggestService(postgres.NewSuggestRepository(db))
+	if err := suggestService.Rebuild(); err != nil {
+		log.Printf("Failed to build suggestion index: %v", err)
+	}
+	go suggestService.RefreshEvery(indexRefreshInterval)
+
+	analyticsService := service.NewAnalyticsService(postgres.NewAnalyticsRepository(db))
+	// Использования копятся в памяти и записываются в базу пачками
+	usageRepo := postgres.NewUsageRepository(db)
+	usageBuffer := service.NewUsageBuffer(usageRepo, cfg.UsageFlushInterval)
+	usageBuffer.Start()
+	licenseService := service.NewLicenseService(postgres.NewLicenseRepository(db), cfg.LicenseGrantTTL)
+	usageService := service.NewUsageService(usageRepo, usageBuffer, licenseService, cfg.UsageDedupWindow)
+	usageReportService := service.NewUsageReportService(usageRepo)
+	recentService := service.NewRecentService(usageRepo, imageRepo, usageBuffer, licenseService)
+	shutdown := func() {
+		if err := usageBuffer.Close(); err != nil {
+			log.Printf("Failed to flush usage buffer on shutdown: %v", err)
+		}
+	}
+
+	// Популярность пересчитывается в материализованном представлении, а не на каждый запрос
+	trendingService := service.NewTrendingService(imageRepo)
+	if err := trendingService.Refresh(); err != nil {
+		log.Printf("Failed to refresh trending images: %v", err)
+	}
+	go trendingService.RefreshEvery(trendingRefreshInterval)
+
+	// Пересчёт совместного использования идёт по всему журналу за 90 дней, поэтому и первый пересчёт
+	// выполняется в фоне: до него рекомендации отдаются из уже существующего представления
+	recommendationService := service.NewRecommendationService(imageRepo)
+	go func() {
+		if err := recommendationService.Refresh(); err != nil {
+			log.Printf("Failed to refresh co-usage statistics: %v", err)
+		}
+		recommendationService.RefreshEvery(recommendationRefreshInterval)
+	}()
+
+	similarService := service.NewSimilarService(imageRepo)
+	if err := similarService.Rebuild(); err != nil {
+		log.Printf("Failed to build similarity index: %v", err)
+	}
+	go similarService.RefreshEvery(indexRefreshInterval)
+
+	// Изменения каталога через админку и cmd/ingest сразу перестраивают индексы, не дожидаясь обновления
+	indexService := service.NewIndexService(suggestService, similarService)
+	uploadService := service.NewUploadService(db, imageRepo, indexService, imagesFolder, renditions)
+	organizeService := service.NewOrganizeService(db, imageRepo, indexService, imagesFolder)
+
 	// Create an instance of MyHandler
 	myHandler := &MyHandler{}
 
@@ -198,7 +284,7 @@ func NewRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	r.Use(setCORSHeaders)
 	// Use checkMiddleware before all other handlers
 	r.Use(func(next http.Handler) http.Handler {
-		return checkMiddleware(next, myHandler)
+		return checkMiddleware(next, myHandler, licenseService)
 	})
 
 	r.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
@@ -219,10 +305,59 @@ func NewRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 		}
 		log.Println("/IncreaseImageUsage! 2", myHandler.IsCheckSuccessful())
 
-		handler.IncreaseImageUsage(imageService)(w, r)
+		handler.IncreaseImageUsage(usageService, analyticsService, cfg)(w, r)
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/images/{id:[0-9]+}/usage", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.RecordImageUsage(usageService, analyticsService)(w, r)
 	}).Methods("POST", "OPTIONS")
 
-	r.PathPrefix("/static/images/").Handler(http.StripPrefix("/static/images/", http.FileServer(http.Dir("./static/images/"))))
+	r.HandleFunc("/usage/batch", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.RecordUsageBatch(usageService, analyticsService)(w, r)
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/me/recent", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			handler.ClearRecentImages(recentService)(w, r)
+			return
+		}
+		handler.GetRecentImages(recentService, cfg)(w, r)
+	}).Methods("GET", "DELETE", "OPTIONS")
+
+	// Админские отчёты и операции, доступ по ADMIN_TOKEN
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(adminMiddleware(cfg))
+	admin.HandleFunc("/search/top-queries", handler.GetTopSearchQueries(analyticsService)).Methods("GET")
+	admin.HandleFunc("/search/zero-results", handler.GetZeroResultSearchQueries(analyticsService)).Methods("GET")
+	admin.HandleFunc("/search/click-through", handler.GetSearchClickThrough(analyticsService)).Methods("GET")
+	admin.HandleFunc("/usage/events", handler.GetUsageEvents(usageService)).Methods("GET")
+	admin.HandleFunc("/usage/buffer", handler.GetUsageBufferStats(usageService)).Methods("GET")
+	admin.HandleFunc("/usage/spikes", handler.GetUsageSpikes(usageService)).Methods("GET")
+	admin.HandleFunc("/usage/report", handler.GetUsageReport(usageReportService)).Methods("GET")
+	admin.HandleFunc("/indexes/rebuild", handler.RebuildIndexes(indexService)).Methods("POST")
+	admin.HandleFunc("/images", handler.UploadImage(uploadService, cfg)).Methods("POST")
+	admin.HandleFunc("/images/{id:[0-9]+}", handler.DeleteImage(organizeService)).Methods("DELETE")
+	admin.HandleFunc("/images/{id:[0-9]+}/move", handler.MoveImage(organizeService, cfg)).Methods("POST")
+	admin.HandleFunc("/families/{family}", handler.RenameTaxonomy(organizeService)).Methods("PATCH")
+	admin.HandleFunc("/families/{family}/groups/{group}", handler.RenameTaxonomy(organizeService)).Methods("PATCH")
+	admin.HandleFunc("/families/{family}/groups/{group}/subgroups/{subgroup}", handler.RenameTaxonomy(organizeService)).Methods("PATCH")
+
+	r.PathPrefix("/static/images/").Handler(http.StripPrefix("/static/images/", http.FileServer(http.Dir(imagesFolder))))
 
 	r.HandleFunc("/{family}/{group}/{subgroup}/{number:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("/GetImageByNumber! 1", myHandler.IsCheckSuccessful())
@@ -260,6 +395,15 @@ func NewRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 		handler.GetLeastUsedImages(imageService, cfg)(w, r)
 	}).Methods("GET")
 
+	r.HandleFunc("/trending", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.GetTrendingImages(trendingService, cfg)(w, r)
+	}).Methods("GET")
+
 	r.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("/SearchImages! 1", myHandler.IsCheckSuccessful())
 
@@ -269,8 +413,35 @@ func NewRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 		}
 		log.Println("/SearchImages! 2", myHandler.IsCheckSuccessful())
 
-		handler.SearchImages(imageService, cfg)(w, r)
+		handler.SearchImages(imageService, suggestService, analyticsService, cfg)(w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/images/{id:[0-9]+}/similar", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.GetSimilarImages(similarService, cfg)(w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/images/{id:[0-9]+}/recommendations", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.GetRecommendations(recommendationService, cfg)(w, r)
+	}).Methods("GET")
+
+	r.HandleFunc("/search/suggest", func(w http.ResponseWriter, r *http.Request) {
+		if !myHandler.IsCheckSuccessful() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.SuggestSearch(suggestService)(w, r)
 	}).Methods("GET")
 
-	return r
+	return r, shutdown
 }
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"HorizonBackend/internal/suggest"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// Использование изображения засчитывается как переход из поиска, если случилось в течение этого окна
+const clickThroughWindow = 30 * time.Minute
+
+type AnalyticsService interface {
+	RecordSearch(query, family, uuid string, resultCount int)
+	RecordClick(uuid string, imageID int)
+	GetTopQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error)
+	GetZeroResultQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error)
+	GetClickThrough(from, to time.Time, limit int) ([]model.SearchQueryStat, error)
+}
+
+type analyticsServiceImpl struct {
+	repo *postgres.AnalyticsRepository
+}
+
+func NewAnalyticsService(repo *postgres.AnalyticsRepository) AnalyticsService {
+	return &analyticsServiceImpl{repo: repo}
+}
+
+// HashUUID возвращает необратимый идентификатор пользователя для аналитики.
+// Сами UUID лицензий в таблицах аналитики не хранятся.
+func HashUUID(uuid string) string {
+	if uuid == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(uuid))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *analyticsServiceImpl) RecordSearch(query, family, uuid string, resultCount int) {
+	query = suggest.Normalize(query)
+	if query == "" {
+		return
+	}
+	if err := s.repo.RecordSearch(query, family, HashUUID(uuid), resultCount); err != nil {
+		log.Printf("Service error recording search %q: %v", query, err)
+	}
+}
+
+func (s *analyticsServiceImpl) RecordClick(uuid string, imageID int) {
+	if uuid == "" || imageID == 0 {
+		return
+	}
+	if err := s.repo.RecordClick(HashUUID(uuid), imageID, clickThroughWindow); err != nil {
+		log.Printf("Service error recording search click for image %d: %v", imageID, err)
+	}
+}
+
+func (s *analyticsServiceImpl) GetTopQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return s.repo.GetTopQueries(from, to, limit)
+}
+
+func (s *analyticsServiceImpl) GetZeroResultQueries(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return s.repo.GetZeroResultQueries(from, to, limit)
+}
+
+func (s *analyticsServiceImpl) GetClickThrough(from, to time.Time, limit int) ([]model.SearchQueryStat, error) {
+	return s.repo.GetClickThrough(from, to, limit)
+}
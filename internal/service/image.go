@@ -2,17 +2,31 @@ package service
 
 import (
 	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/palette"
 	"HorizonBackend/internal/repository/postgres"
 	"errors"
 	"log"
+	"sort"
+	"time"
+)
+
+// Цвета палитры, занимающие меньшую долю изображения, не участвуют в поиске по цвету
+const minSwatchWeight = 0.05
+
+const (
+	// Из скольких кандидатов (в разах от запрошенного числа) выбирается подборка наименее используемых
+	noveltyPoolFactor = 8
+	maxNoveltyPool    = 400
+	// Сколько помним, что изображение уже показывали пользователю в подборке
+	impressionMemory = 24 * time.Hour
 )
 
 type ImageService interface {
-	GetImagesByFamilyGroupSubgroup(family, group, subgroup string) ([]model.Image, error)
-	SearchImages(keyword, family string) ([]model.Image, error)
+	GetImagesByFamilyGroupSubgroup(family, group, subgroup string, filter model.ImageFilter) ([]model.Image, error)
+	SearchImages(keyword, family string, filter model.ImageFilter) ([]model.Image, error)
+	SearchImagesByColor(keyword, family string, color palette.Color, tolerance float64, filter model.ImageFilter) ([]model.Image, error)
 	GetImageByNumber(family, group, subgroup, imageNumber string) (*model.Image, error)
-	IncreaseUsageCount(thumbPath string) error
-	GetLeastUsedImages(family string, limit int) ([]model.Image, error)
+	GetLeastUsedImages(family, licenseUUID string, limit int, filter model.ImageFilter) ([]model.Image, error)
 }
 
 type imageServiceImpl struct {
@@ -23,7 +37,7 @@ func NewImageService(repo *postgres.ImageRepository) ImageService {
 	return &imageServiceImpl{repo: repo}
 }
 
-func (s *imageServiceImpl) GetImagesByFamilyGroupSubgroup(family, group, subgroup string) ([]model.Image, error) {
+func (s *imageServiceImpl) GetImagesByFamilyGroupSubgroup(family, group, subgroup string, filter model.ImageFilter) ([]model.Image, error) {
 	// Валидация
 	if family == "" || group == "" {
 		log.Println("Invalid input: family, group or subgroup is empty")
@@ -31,7 +45,7 @@ func (s *imageServiceImpl) GetImagesByFamilyGroupSubgroup(family, group, subgrou
 	}
 
 	// Получение изображений
-	images, err := s.repo.GetImagesByFamilyGroupSubgroup(family, group, subgroup)
+	images, err := s.repo.GetImagesByFamilyGroupSubgroup(family, group, subgroup, filter)
 	if err != nil {
 		log.Printf("Service error fetching images for family: %s, group: %s and subgroup: %s Error: %v", family, group, subgroup, err)
 		return nil, err
@@ -44,8 +58,53 @@ func (s *imageServiceImpl) GetImagesByFamilyGroupSubgroup(family, group, subgrou
 	return images, nil
 }
 
-func (s *imageServiceImpl) SearchImages(keyword, family string) ([]model.Image, error) {
-	return s.repo.SearchImagesByKeywordAndFamily(keyword, family)
+func (s *imageServiceImpl) SearchImages(keyword, family string, filter model.ImageFilter) ([]model.Image, error) {
+	return s.repo.SearchImagesByKeywordAndFamily(keyword, family, filter)
+}
+
+// SearchImagesByColor ранжирует изображения по перцептивной близости (CIEDE2000)
+// ближайшего из доминирующих цветов к искомому. Изображения дальше tolerance отбрасываются.
+func (s *imageServiceImpl) SearchImagesByColor(keyword, family string, color palette.Color, tolerance float64, filter model.ImageFilter) ([]model.Image, error) {
+	images, err := s.repo.GetImagesWithPalettes(keyword, family, filter)
+	if err != nil {
+		log.Printf("Service error searching images by color %s, keyword: %s, family: %s Error: %v", color.Hex(), keyword, family, err)
+		return nil, err
+	}
+
+	type match struct {
+		image    model.Image
+		distance float64
+		weight   float64
+	}
+	matches := make([]match, 0, len(images))
+	for _, img := range images {
+		best := match{distance: -1}
+		for _, c := range img.Palette {
+			if c.Weight < minSwatchWeight {
+				continue
+			}
+			d := palette.DeltaE2000(color.Lab, palette.Lab{L: c.L, A: c.A, B: c.B})
+			if best.distance < 0 || d < best.distance {
+				best = match{image: img, distance: d, weight: c.Weight}
+			}
+		}
+		if best.distance >= 0 && best.distance <= tolerance {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].weight > matches[j].weight
+	})
+
+	result := make([]model.Image, len(matches))
+	for i, m := range matches {
+		result[i] = m.image
+	}
+	return result, nil
 }
 
 func (s *imageServiceImpl) GetImageByNumber(family, group, subgroup, imageNumber string) (*model.Image, error) {
@@ -57,10 +116,88 @@ func (s *imageServiceImpl) GetImageByNumber(family, group, subgroup, imageNumber
 	return image, nil
 }
 
-func (s *imageServiceImpl) IncreaseUsageCount(thumbPath string) error {
-	return s.repo.IncreaseUsageCount(thumbPath)
+// GetLeastUsedImages подбирает наименее используемые изображения без тех, которые пользователь уже
+// использовал или которые ему показывали за impressionMemory; если таких не осталось, подборка короче.
+// Изображения распределяются по подгруппам, чтобы одна подгруппа не занимала всю подборку, а равные
+// по использованию кандидаты перемешиваются по seed пользователя.
+func (s *imageServiceImpl) GetLeastUsedImages(family, licenseUUID string, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	if limit <= 0 {
+		return []model.Image{}, nil
+	}
+
+	poolSize := limit * noveltyPoolFactor
+	if poolSize > maxNoveltyPool {
+		poolSize = maxNoveltyPool
+	}
+	// Seed меняется раз в сутки, чтобы подборка пользователя не застывала
+	seed := licenseUUID + ":" + time.Now().UTC().Format("2006-01-02")
+	shownSince := time.Now().Add(-impressionMemory)
+
+	candidates, err := s.repo.GetLeastUsedCandidates(family, licenseUUID, seed, shownSince, poolSize, filter)
+	if err != nil {
+		log.Printf("Service error fetching least used images for family: %s Error: %v", family, err)
+		return nil, err
+	}
+
+	images := spreadAcrossSubgroups(candidates, limit)
+
+	if licenseUUID != "" && len(images) > 0 {
+		ids := make([]int, len(images))
+		for i, img := range images {
+			ids[i] = img.ID
+		}
+		if err := s.repo.RecordImpressions(licenseUUID, ids); err != nil {
+			log.Printf("Service error recording impressions for least used images: %v", err)
+		}
+	}
+
+	return images, nil
 }
 
-func (s *imageServiceImpl) GetLeastUsedImages(family string, limit int) ([]model.Image, error) {
-	return s.repo.GetLeastUsedImages(family, limit)
+// spreadAcrossSubgroups выбирает limit кандидатов, чередуя подгруппы в порядке появления их лучших
+// кандидатов. Ни одна подгруппа не получает больше своей доли, пока хватает кандидатов из других.
+func spreadAcrossSubgroups(candidates []model.Image, limit int) []model.Image {
+	var order []int
+	queues := make(map[int][]model.Image)
+	for _, img := range candidates {
+		if _, ok := queues[img.SubgroupID]; !ok {
+			order = append(order, img.SubgroupID)
+		}
+		queues[img.SubgroupID] = append(queues[img.SubgroupID], img)
+	}
+	if len(order) == 0 {
+		return []model.Image{}
+	}
+	perSubgroup := (limit + len(order) - 1) / len(order)
+
+	result := make([]model.Image, 0, limit)
+	taken := make(map[int]bool)
+	perSubgroupTaken := make(map[int]int)
+	for progress := true; progress && len(result) < limit; {
+		progress = false
+		for _, id := range order {
+			if len(result) >= limit || len(queues[id]) == 0 || perSubgroupTaken[id] >= perSubgroup {
+				continue
+			}
+			img := queues[id][0]
+			queues[id] = queues[id][1:]
+			result = append(result, img)
+			taken[img.ID] = true
+			perSubgroupTaken[id]++
+			progress = true
+		}
+	}
+
+	// Если кандидатов из других подгрупп не хватило, добираем без ограничения доли
+	for _, img := range candidates {
+		if len(result) >= limit {
+			break
+		}
+		if !taken[img.ID] {
+			result = append(result, img)
+			taken[img.ID] = true
+		}
+	}
+
+	return result
 }
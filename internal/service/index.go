@@ -0,0 +1,69 @@
+package service
+
+import (
+	"log"
+	"sync"
+)
+
+// Rebuilder — индекс в памяти, который строится заново по данным из базы
+type Rebuilder interface {
+	Rebuild() error
+}
+
+// IndexService перестраивает индексы в памяти (автодополнение, похожие изображения) после изменений
+// каталога: загрузки, переноса, переименования и удаления изображений
+type IndexService interface {
+	// Rebuild перестраивает все индексы и возвращает первую ошибку
+	Rebuild() error
+	// RebuildAsync перестраивает индексы в фоне. Вызовы во время перестройки объединяются в одну следующую.
+	RebuildAsync()
+}
+
+type indexServiceImpl struct {
+	indexes []Rebuilder
+
+	mu      sync.Mutex
+	running bool
+	pending bool
+}
+
+func NewIndexService(indexes ...Rebuilder) IndexService {
+	return &indexServiceImpl{indexes: indexes}
+}
+
+func (s *indexServiceImpl) Rebuild() error {
+	var first error
+	for _, index := range s.indexes {
+		if err := index.Rebuild(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *indexServiceImpl) RebuildAsync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.pending = true
+		return
+	}
+	s.running = true
+
+	go func() {
+		for {
+			if err := s.Rebuild(); err != nil {
+				log.Printf("Service error rebuilding indexes after catalog change: %v", err)
+			}
+
+			s.mu.Lock()
+			if !s.pending {
+				s.running = false
+				s.mu.Unlock()
+				return
+			}
+			s.pending = false
+			s.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"HorizonBackend/internal/repository/postgres"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Сколько помним, что у UUID нет действующей лицензии, чтобы не ходить в базу на каждый запрос
+	licenseNegativeCacheTTL = 30 * time.Second
+	// Кэш сбрасывается целиком, если в нём накопилось столько UUID (например, при переборе случайных UUID)
+	maxLicenseCacheSize = 100000
+)
+
+type LicenseService interface {
+	Grant(licenseUUID string)
+	HasValidGrant(licenseUUID string) bool
+}
+
+type licenseServiceImpl struct {
+	repo *postgres.LicenseRepository
+	ttl  time.Duration
+
+	mu sync.Mutex
+	// UUID -> до какого времени верен закэшированный ответ; valid — есть ли лицензия
+	cache map[string]licenseCacheEntry
+}
+
+type licenseCacheEntry struct {
+	valid bool
+	until time.Time
+}
+
+// NewLicenseService создаёт сервис лицензий; успешная проверка /check действует ttl
+func NewLicenseService(repo *postgres.LicenseRepository, ttl time.Duration) LicenseService {
+	return &licenseServiceImpl{repo: repo, ttl: ttl, cache: make(map[string]licenseCacheEntry)}
+}
+
+// Grant запоминает UUID, успешно прошедший /check
+func (s *licenseServiceImpl) Grant(licenseUUID string) {
+	if licenseUUID == "" {
+		return
+	}
+	expiresAt := time.Now().Add(s.ttl)
+	if err := s.repo.SaveGrant(licenseUUID, expiresAt); err != nil {
+		log.Printf("Service error saving license grant: %v", err)
+	}
+
+	s.mu.Lock()
+	s.cache[licenseUUID] = licenseCacheEntry{valid: true, until: expiresAt}
+	s.mu.Unlock()
+}
+
+// HasValidGrant проверяет, что UUID проходил /check и срок действия проверки не истёк
+func (s *licenseServiceImpl) HasValidGrant(licenseUUID string) bool {
+	if licenseUUID == "" {
+		return false
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.cache[licenseUUID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.valid
+	}
+
+	expiresAt, err := s.repo.GetGrantExpiry(licenseUUID)
+	if err != nil {
+		log.Printf("Service error checking license grant: %v", err)
+		return false
+	}
+
+	entry = licenseCacheEntry{valid: now.Before(expiresAt), until: expiresAt}
+	if !entry.valid {
+		entry.until = now.Add(licenseNegativeCacheTTL)
+	}
+
+	s.mu.Lock()
+	if len(s.cache) > maxLicenseCacheSize {
+		s.cache = make(map[string]licenseCacheEntry)
+	}
+	s.cache[licenseUUID] = entry
+	s.mu.Unlock()
+
+	return entry.valid
+}
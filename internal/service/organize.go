@@ -0,0 +1,89 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"HorizonBackend/scripts"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+var (
+	// ErrTaxonomyNotFound — переименовываемое семейство, группа или подгруппа не найдены
+	ErrTaxonomyNotFound = errors.New("family, group or subgroup not found")
+	// ErrCatalogConflict — узел таксономии, изображение или файл с таким именем уже есть
+	ErrCatalogConflict = scripts.ErrConflict
+	// ErrInvalidName — имя семейства, группы или подгруппы содержит не только латинские буквы и цифры
+	ErrInvalidName = scripts.ErrInvalidName
+)
+
+// OrganizeService переименовывает таксономию, переносит и удаляет изображения, меняя файлы на диске
+// и записи в базе вместе. При переименовании и переносе ID изображений и история их использования
+// сохраняются; удаление стирает и историю. После каждого изменения индексы в памяти перестраиваются в фоне.
+type OrganizeService interface {
+	// RenameTaxonomy переименовывает семейство ([family]), группу ([family, group]) или подгруппу
+	// ([family, group, subgroup]) и возвращает число перенесённых изображений
+	RenameTaxonomy(ctx context.Context, path []string, newName string) (int, error)
+	MoveImage(ctx context.Context, imageID int, family, group, subgroup string) (model.Image, error)
+	DeleteImage(ctx context.Context, imageID int) error
+}
+
+type organizeServiceImpl struct {
+	db         *sql.DB
+	repo       *postgres.ImageRepository
+	indexes    IndexService
+	baseFolder string
+}
+
+func NewOrganizeService(db *sql.DB, repo *postgres.ImageRepository, indexes IndexService, baseFolder string) OrganizeService {
+	return &organizeServiceImpl{db: db, repo: repo, indexes: indexes, baseFolder: baseFolder}
+}
+
+func (s *organizeServiceImpl) RenameTaxonomy(ctx context.Context, path []string, newName string) (int, error) {
+	moved, err := scripts.RenameTaxonomy(ctx, s.db, s.baseFolder, path, newName)
+	if err != nil {
+		return 0, s.mapError(err, ErrTaxonomyNotFound, "renaming %v to %s", path, newName)
+	}
+	log.Printf("Renamed %v to %s, %d images moved", path, newName, moved)
+	s.indexes.RebuildAsync()
+	return moved, nil
+}
+
+func (s *organizeServiceImpl) MoveImage(ctx context.Context, imageID int, family, group, subgroup string) (model.Image, error) {
+	name, err := scripts.MoveImage(ctx, s.db, s.baseFolder, imageID, family, group, subgroup)
+	if err != nil {
+		return model.Image{}, s.mapError(err, ErrImageNotFound, "moving image %d to %s/%s/%s", imageID, family, group, subgroup)
+	}
+	log.Printf("Moved image %d to %s/%s/%s as %s", imageID, family, group, subgroup, name)
+	s.indexes.RebuildAsync()
+
+	img, err := s.repo.GetImageByID(imageID)
+	if err != nil {
+		log.Printf("Service error fetching moved image %d: %v", imageID, err)
+		return model.Image{}, err
+	}
+	return img, nil
+}
+
+func (s *organizeServiceImpl) DeleteImage(ctx context.Context, imageID int) error {
+	if err := scripts.DeleteImage(ctx, s.db, s.baseFolder, imageID); err != nil {
+		return s.mapError(err, ErrImageNotFound, "deleting image %d", imageID)
+	}
+	log.Printf("Deleted image %d", imageID)
+	s.indexes.RebuildAsync()
+	return nil
+}
+
+// mapError заменяет scripts.ErrNotFound на notFound и логирует ошибки, не связанные с запросом
+func (s *organizeServiceImpl) mapError(err, notFound error, format string, args ...interface{}) error {
+	switch {
+	case errors.Is(err, scripts.ErrNotFound):
+		return notFound
+	case errors.Is(err, ErrCatalogConflict), errors.Is(err, ErrInvalidName):
+		return err
+	}
+	log.Printf("Service error "+format+": %v", append(args, err)...)
+	return err
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"log"
+	"sort"
+)
+
+type RecentService interface {
+	GetRecentImages(licenseUUID string, limit int) ([]model.Image, error)
+	ClearHistory(licenseUUID string) error
+}
+
+type recentServiceImpl struct {
+	usageRepo *postgres.UsageRepository
+	imageRepo *postgres.ImageRepository
+	buffer    *UsageBuffer
+	licenses  LicenseService
+}
+
+func NewRecentService(usageRepo *postgres.UsageRepository, imageRepo *postgres.ImageRepository, buffer *UsageBuffer, licenses LicenseService) RecentService {
+	return &recentServiceImpl{usageRepo: usageRepo, imageRepo: imageRepo, buffer: buffer, licenses: licenses}
+}
+
+// GetRecentImages возвращает до limit разных изображений, которые лицензия использовала последними.
+// Использования из буфера, ещё не записанные в базу, тоже учитываются. Историю видит только UUID
+// с действующей проверкой лицензии, иначе — ErrLicenseRequired.
+func (s *recentServiceImpl) GetRecentImages(licenseUUID string, limit int) ([]model.Image, error) {
+	if !s.licenses.HasValidGrant(licenseUUID) {
+		return nil, ErrLicenseRequired
+	}
+
+	clearedAt, err := s.usageRepo.GetHistoryClearedAt(licenseUUID)
+	if err != nil {
+		log.Printf("Service error fetching history reset for recent images: %v", err)
+		return nil, err
+	}
+
+	pending := s.buffer.PendingForLicense(licenseUUID)
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].LastSeen.After(pending[j].LastSeen)
+	})
+
+	stored, err := s.usageRepo.GetRecentImageIDs(licenseUUID, clearedAt, limit)
+	if err != nil {
+		log.Printf("Service error fetching recent images: %v", err)
+		return nil, err
+	}
+
+	ids := make([]int, 0, limit)
+	seen := make(map[int]bool, limit)
+	add := func(id int) {
+		if len(ids) < limit && !seen[id] {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+	for _, p := range pending {
+		if p.LastSeen.After(clearedAt) {
+			add(p.ImageID)
+		}
+	}
+	for _, id := range stored {
+		add(id)
+	}
+
+	images, err := s.imageRepo.GetImagesByIDs(ids)
+	if err != nil {
+		log.Printf("Service error fetching recent images by ids: %v", err)
+		return nil, err
+	}
+	return images, nil
+}
+
+// ClearHistory очищает историю недавно использованных изображений лицензии; как и чтение истории,
+// доступно только UUID с действующей проверкой лицензии
+func (s *recentServiceImpl) ClearHistory(licenseUUID string) error {
+	if !s.licenses.HasValidGrant(licenseUUID) {
+		return ErrLicenseRequired
+	}
+	if err := s.usageRepo.ClearHistory(licenseUUID); err != nil {
+		log.Printf("Service error clearing recent images history: %v", err)
+		return err
+	}
+	return nil
+}
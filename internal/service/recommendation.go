@@ -0,0 +1,62 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+type RecommendationService interface {
+	GetRecommendations(imageID int, family string, limit int, filter model.ImageFilter) ([]model.Image, error)
+	Refresh() error
+	RefreshEvery(interval time.Duration)
+}
+
+type recommendationServiceImpl struct {
+	repo *postgres.ImageRepository
+}
+
+func NewRecommendationService(repo *postgres.ImageRepository) RecommendationService {
+	return &recommendationServiceImpl{repo: repo}
+}
+
+// GetRecommendations возвращает изображения из других семейств, которые часто используют вместе с imageID.
+// Для неизвестного изображения возвращает ErrImageNotFound.
+func (s *recommendationServiceImpl) GetRecommendations(imageID int, family string, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	if _, err := s.repo.GetImageByID(imageID); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImageNotFound
+	} else if err != nil {
+		log.Printf("Service error fetching image %d for recommendations: %v", imageID, err)
+		return nil, err
+	}
+
+	images, err := s.repo.GetCoUsedImages(imageID, family, limit, filter)
+	if err != nil {
+		log.Printf("Service error fetching recommendations for image %d: %v", imageID, err)
+		return nil, err
+	}
+	return images, nil
+}
+
+func (s *recommendationServiceImpl) Refresh() error {
+	started := time.Now()
+	if err := s.repo.RefreshCoUsage(); err != nil {
+		log.Printf("Service error refreshing co-usage statistics: %v", err)
+		return err
+	}
+	log.Printf("Co-usage statistics refreshed in %v", time.Since(started))
+	return nil
+}
+
+// RefreshEvery периодически пересчитывает совместное использование. Блокирует вызывающую горутину.
+func (s *recommendationServiceImpl) RefreshEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_ = s.Refresh()
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"HorizonBackend/internal/bktree"
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/phash"
+	"HorizonBackend/internal/repository/postgres"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Радиус поиска начинается с малого и расширяется, пока не наберётся нужное число похожих
+	similarInitialRadius = 8
+	similarRadiusStep    = 8
+	// Дальше этого расстояния (из 128 бит) изображения уже не считаются похожими
+	similarMaxRadius = 48
+)
+
+// ErrImageNotIndexed — для изображения нет перцептивного хэша (например, SVG или ещё не обработано)
+var ErrImageNotIndexed = errors.New("image has no perceptual hash")
+
+type SimilarService interface {
+	FindSimilar(imageID int, family string, limit int) ([]model.Image, error)
+	Rebuild() error
+	RefreshEvery(interval time.Duration)
+}
+
+type similarIndex struct {
+	tree *bktree.Tree[model.ImageHash]
+	byID map[int]model.ImageHash
+}
+
+type similarServiceImpl struct {
+	repo *postgres.ImageRepository
+
+	mu    sync.RWMutex
+	index *similarIndex
+}
+
+func NewSimilarService(repo *postgres.ImageRepository) SimilarService {
+	return &similarServiceImpl{repo: repo, index: newSimilarIndex()}
+}
+
+func hashDistance(a, b model.ImageHash) int {
+	return phash.Hash{PHash: a.PHash, DHash: a.DHash}.Distance(phash.Hash{PHash: b.PHash, DHash: b.DHash})
+}
+
+func newSimilarIndex() *similarIndex {
+	return &similarIndex{
+		tree: bktree.New[model.ImageHash](hashDistance),
+		byID: make(map[int]model.ImageHash),
+	}
+}
+
+// FindSimilar возвращает до limit видимых изображений, ближайших к imageID по расстоянию Хэмминга.
+// Непустой family ограничивает результат одним семейством.
+func (s *similarServiceImpl) FindSimilar(imageID int, family string, limit int) ([]model.Image, error) {
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+
+	source, ok := index.byID[imageID]
+	if !ok {
+		return nil, ErrImageNotIndexed
+	}
+
+	var found []bktree.Result[model.ImageHash]
+	for radius := similarInitialRadius; radius <= similarMaxRadius; radius += similarRadiusStep {
+		found = found[:0]
+		for _, res := range index.tree.Search(source, radius) {
+			if res.Item.ImageID == imageID || (family != "" && res.Item.Family != family) {
+				continue
+			}
+			found = append(found, res)
+		}
+		if len(found) >= limit {
+			break
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Distance != found[j].Distance {
+			return found[i].Distance < found[j].Distance
+		}
+		return found[i].Item.ImageID < found[j].Item.ImageID
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	ids := make([]int, len(found))
+	for i, res := range found {
+		ids[i] = res.Item.ImageID
+	}
+
+	images, err := s.repo.GetImagesByIDs(ids)
+	if err != nil {
+		log.Printf("Service error fetching similar images for %d: %v", imageID, err)
+		return nil, err
+	}
+	return images, nil
+}
+
+// Rebuild загружает хэши из базы и строит новое BK-дерево. В дерево попадают только
+// видимые изображения, но искать похожие можно для любого изображения с хэшем.
+func (s *similarServiceImpl) Rebuild() error {
+	started := time.Now()
+
+	hashes, err := s.repo.GetImageHashes()
+	if err != nil {
+		log.Printf("Service error loading image hashes: %v", err)
+		return err
+	}
+
+	index := newSimilarIndex()
+	for _, h := range hashes {
+		index.byID[h.ImageID] = h
+		if h.Visible {
+			index.tree.Add(h)
+		}
+	}
+
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+
+	log.Printf("Similarity index rebuilt: %d images in %v", index.tree.Len(), time.Since(started))
+	return nil
+}
+
+// RefreshEvery периодически перестраивает индекс. Блокирует вызывающую горутину.
+func (s *similarServiceImpl) RefreshEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_ = s.Rebuild()
+	}
+}
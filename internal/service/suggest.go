@@ -0,0 +1,85 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"HorizonBackend/internal/suggest"
+	"log"
+	"sync"
+	"time"
+)
+
+// Запросы короче этого не попадают в популярные
+const minRecordedQueryLength = 2
+
+type SuggestService interface {
+	Suggest(prefix, family string, limit int) []model.Suggestion
+	RecordQuery(query, family string, resultCount int)
+	Rebuild() error
+	RefreshEvery(interval time.Duration)
+}
+
+type suggestServiceImpl struct {
+	repo *postgres.SuggestRepository
+
+	mu   sync.RWMutex
+	trie *suggest.Trie
+}
+
+func NewSuggestService(repo *postgres.SuggestRepository) SuggestService {
+	return &suggestServiceImpl{repo: repo, trie: suggest.NewTrie()}
+}
+
+func (s *suggestServiceImpl) Suggest(prefix, family string, limit int) []model.Suggestion {
+	s.mu.RLock()
+	trie := s.trie
+	s.mu.RUnlock()
+
+	return trie.Suggest(prefix, family, limit)
+}
+
+// RecordQuery запоминает запрос для автодополнения. Запросы без результатов не записываются,
+// чтобы подсказка никогда не вела к пустой выдаче.
+func (s *suggestServiceImpl) RecordQuery(query, family string, resultCount int) {
+	query = suggest.Normalize(query)
+	if resultCount == 0 || len([]rune(query)) < minRecordedQueryLength {
+		return
+	}
+	if err := s.repo.RecordQuery(query, family); err != nil {
+		log.Printf("Service error recording search query %q: %v", query, err)
+	}
+}
+
+// Rebuild заново строит индекс по данным из базы и подменяет им текущий
+func (s *suggestServiceImpl) Rebuild() error {
+	started := time.Now()
+
+	sources, err := s.repo.GetSuggestionSources()
+	if err != nil {
+		log.Printf("Service error loading suggestion sources: %v", err)
+		return err
+	}
+
+	trie := suggest.NewTrie()
+	for _, src := range sources {
+		trie.Add(src)
+	}
+
+	s.mu.Lock()
+	s.trie = trie
+	s.mu.Unlock()
+
+	log.Printf("Suggestion index rebuilt: %d terms in %v", trie.Len(), time.Since(started))
+	return nil
+}
+
+// RefreshEvery периодически перестраивает индекс, чтобы подтягивать новые популярные запросы
+// и изменения каталога. Блокирует вызывающую горутину.
+func (s *suggestServiceImpl) RefreshEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_ = s.Rebuild()
+	}
+}
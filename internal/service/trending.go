@@ -0,0 +1,58 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"log"
+	"time"
+)
+
+// TrendingWindows — окна популярности (в днях), которые считает представление image_trending
+var TrendingWindows = map[string]int{
+	"1d":  1,
+	"7d":  7,
+	"30d": 30,
+}
+
+type TrendingService interface {
+	GetTrendingImages(family string, windowDays, limit int, filter model.ImageFilter) ([]model.Image, error)
+	Refresh() error
+	RefreshEvery(interval time.Duration)
+}
+
+type trendingServiceImpl struct {
+	repo *postgres.ImageRepository
+}
+
+func NewTrendingService(repo *postgres.ImageRepository) TrendingService {
+	return &trendingServiceImpl{repo: repo}
+}
+
+func (s *trendingServiceImpl) GetTrendingImages(family string, windowDays, limit int, filter model.ImageFilter) ([]model.Image, error) {
+	images, err := s.repo.GetTrendingImages(family, windowDays, limit, filter)
+	if err != nil {
+		log.Printf("Service error fetching trending images for family: %s, window: %dd Error: %v", family, windowDays, err)
+		return nil, err
+	}
+	return images, nil
+}
+
+func (s *trendingServiceImpl) Refresh() error {
+	started := time.Now()
+	if err := s.repo.RefreshTrending(); err != nil {
+		log.Printf("Service error refreshing trending images: %v", err)
+		return err
+	}
+	log.Printf("Trending images refreshed in %v", time.Since(started))
+	return nil
+}
+
+// RefreshEvery периодически пересчитывает популярность. Блокирует вызывающую горутину.
+func (s *trendingServiceImpl) RefreshEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_ = s.Refresh()
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"HorizonBackend/scripts"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+)
+
+// ErrInvalidUpload — некорректные имена таксономии или файл неизвестного формата
+var ErrInvalidUpload = scripts.ErrInvalidUpload
+
+// UploadResult — добавленное изображение и предупреждения загрузки (некорректный _meta подгруппы,
+// не удалось проанализировать изображение)
+type UploadResult struct {
+	Image    model.Image         `json:"image"`
+	Warnings []scripts.FileError `json:"warnings"`
+}
+
+type UploadService interface {
+	Upload(ctx context.Context, family, group, subgroup, fileName string, content io.Reader) (*UploadResult, error)
+}
+
+type uploadServiceImpl struct {
+	db         *sql.DB
+	repo       *postgres.ImageRepository
+	indexes    IndexService
+	baseFolder string
+	renditions []scripts.Rendition
+}
+
+// NewUploadService создаёт службу загрузки изображений в baseFolder ({family}/{group}/{subgroup}/{image})
+// с миниатюрами renditions — теми же, что создаёт cmd/ingest. После загрузки indexes перестраиваются в фоне.
+func NewUploadService(db *sql.DB, repo *postgres.ImageRepository, indexes IndexService, baseFolder string, renditions []scripts.Rendition) UploadService {
+	return &uploadServiceImpl{db: db, repo: repo, indexes: indexes, baseFolder: baseFolder, renditions: renditions}
+}
+
+// Upload сохраняет файл под следующим номером подгруппы, создаёт миниатюры и записывает изображение
+func (s *uploadServiceImpl) Upload(ctx context.Context, family, group, subgroup, fileName string, content io.Reader) (*UploadResult, error) {
+	uploaded, err := scripts.UploadImage(ctx, s.db, s.baseFolder, family, group, subgroup, fileName, content, s.renditions)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidUpload) {
+			log.Printf("Service error uploading image to %s/%s/%s: %v", family, group, subgroup, err)
+		}
+		return nil, err
+	}
+	log.Printf("Uploaded image %s (id %d)", uploaded.Name, uploaded.ImageID)
+	s.indexes.RebuildAsync()
+
+	img, err := s.repo.GetImageByID(uploaded.ImageID)
+	if err != nil {
+		log.Printf("Service error fetching uploaded image %d: %v", uploaded.ImageID, err)
+		return nil, err
+	}
+	warnings := uploaded.Warnings
+	if warnings == nil {
+		warnings = []scripts.FileError{}
+	}
+	return &UploadResult{Image: img, Warnings: warnings}, nil
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Больше стольких использований одного изображения за запрос не записываем
+	MaxUsageCount = 100
+	// Максимальный размер пакета /usage/batch
+	MaxUsageBatch = 200
+	// Наибольшее окно отчёта о всплесках; столько помним отклонённые повторы по лицензиям
+	MaxSpikeWindow = 7 * 24 * time.Hour
+)
+
+var (
+	ErrImageNotFound = errors.New("image not found")
+	// ErrLicenseRequired — у UUID нет действующей проверки лицензии через /check
+	ErrLicenseRequired = errors.New("valid license required")
+)
+
+type UsageService interface {
+	RecordUsage(thumbPath, licenseUUID, action string) (int, error)
+	RecordImageUsage(licenseUUID string, item model.UsageItem) (model.UsageResult, error)
+	RecordUsageBatch(licenseUUID string, items []model.UsageItem) ([]model.UsageResult, error)
+	GetUsageEvents(filter model.UsageEventFilter) ([]model.UsageEvent, int, error)
+	BufferStats() model.UsageBufferStats
+	GetSpikeReport(params model.UsageSpikeParams) (model.UsageSpikeReport, error)
+}
+
+type usageKeyImage struct {
+	licenseUUID string
+	imageID     int
+}
+
+type usageServiceImpl struct {
+	repo     *postgres.UsageRepository
+	buffer   *UsageBuffer
+	licenses LicenseService
+	// Окно дедупликации; 0 — каждое использование засчитывается
+	dedupWindow time.Duration
+
+	mu sync.Mutex
+	// Когда (UUID, изображение) в последний раз засчитано; дополняет usage_events,
+	// пока события лежат в буфере
+	lastCounted map[usageKeyImage]time.Time
+	lastPruned  time.Time
+	// Отклонённые повторы по UUID и часу (Unix-время / 3600) за последние MaxSpikeWindow
+	duplicatesByLicense map[string]map[int64]int64
+	// Общее число отклонений с запуска сервера
+	duplicates int64
+	unlicensed int64
+}
+
+// NewUsageService создаёт сервис, который пишет использования через буфер.
+// Буфер запускает и закрывает вызывающая сторона.
+func NewUsageService(repo *postgres.UsageRepository, buffer *UsageBuffer, licenses LicenseService, dedupWindow time.Duration) UsageService {
+	return &usageServiceImpl{
+		repo:                repo,
+		buffer:              buffer,
+		licenses:            licenses,
+		dedupWindow:         dedupWindow,
+		lastCounted:         make(map[usageKeyImage]time.Time),
+		lastPruned:          time.Now(),
+		duplicatesByLicense: make(map[string]map[int64]int64),
+	}
+}
+
+// checkLicense отклоняет использования от UUID без действующей проверки лицензии
+func (s *usageServiceImpl) checkLicense(licenseUUID string) error {
+	if s.licenses.HasValidGrant(licenseUUID) {
+		return nil
+	}
+	s.mu.Lock()
+	s.unlicensed++
+	s.mu.Unlock()
+	return ErrLicenseRequired
+}
+
+// claim отбирает из ids изображения, которые лицензия ещё не использовала в окне дедупликации,
+// и отмечает их как засчитанные. Повторы учитываются в отчёте о всплесках.
+func (s *usageServiceImpl) claim(licenseUUID string, ids []int) (map[int]bool, error) {
+	claimed := make(map[int]bool, len(ids))
+	if s.dedupWindow <= 0 {
+		for _, id := range ids {
+			claimed[id] = true
+		}
+		return claimed, nil
+	}
+
+	now := time.Now()
+	since := now.Add(-s.dedupWindow)
+	// События, уже записанные в базу (в том числе до перезапуска сервера)
+	used, err := s.repo.GetUsedSince(licenseUUID, ids, since)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPruned) > s.dedupWindow {
+		for key, at := range s.lastCounted {
+			if at.Before(since) {
+				delete(s.lastCounted, key)
+			}
+		}
+		oldest := now.Add(-MaxSpikeWindow).Unix() / 3600
+		for uuid, hours := range s.duplicatesByLicense {
+			for hour := range hours {
+				if hour < oldest {
+					delete(hours, hour)
+				}
+			}
+			if len(hours) == 0 {
+				delete(s.duplicatesByLicense, uuid)
+			}
+		}
+		s.lastPruned = now
+	}
+
+	for _, id := range ids {
+		key := usageKeyImage{licenseUUID: licenseUUID, imageID: id}
+		if at, ok := s.lastCounted[key]; used[id] || claimed[id] || (ok && !at.Before(since)) {
+			hours := s.duplicatesByLicense[licenseUUID]
+			if hours == nil {
+				hours = make(map[int64]int64)
+				s.duplicatesByLicense[licenseUUID] = hours
+			}
+			hours[now.Unix()/3600]++
+			s.duplicates++
+			continue
+		}
+		s.lastCounted[key] = now
+		claimed[id] = true
+	}
+	return claimed, nil
+}
+
+// duplicatesSince возвращает число отклонённых повторов лицензии начиная с часа, в который попадает from
+func (s *usageServiceImpl) duplicatesSince(licenseUUID string, from time.Time) int64 {
+	var n int64
+	for hour, count := range s.duplicatesByLicense[licenseUUID] {
+		if hour >= from.Unix()/3600 {
+			n += count
+		}
+	}
+	return n
+}
+
+// ValidUsageAction проверяет, что действие входит в известный набор
+func ValidUsageAction(action string) bool {
+	switch action {
+	case model.UsageActionInsert, model.UsageActionReplace:
+		return true
+	default:
+		return false
+	}
+}
+
+// RecordUsage записывает использование изображения по пути миниатюры и возвращает ID изображения
+// (0, если путь не найден). Повтор в окне дедупликации не засчитывается, но ошибкой не считается.
+func (s *usageServiceImpl) RecordUsage(thumbPath, licenseUUID, action string) (int, error) {
+	if action == "" {
+		action = model.UsageActionInsert
+	}
+	if !ValidUsageAction(action) {
+		return 0, fmt.Errorf("unknown usage action %q", action)
+	}
+
+	if err := s.checkLicense(licenseUUID); err != nil {
+		return 0, err
+	}
+
+	imageID, err := s.repo.GetImageIDByThumbPath(thumbPath)
+	if err != nil {
+		log.Printf("Service error resolving thumb path %s: %v", thumbPath, err)
+		return 0, err
+	}
+	if imageID == 0 {
+		return 0, nil
+	}
+
+	claimed, err := s.claim(licenseUUID, []int{imageID})
+	if err != nil {
+		log.Printf("Service error checking duplicate usage of image %d: %v", imageID, err)
+		return 0, err
+	}
+	if claimed[imageID] {
+		s.buffer.Add(imageID, licenseUUID, action, 1)
+	}
+	return imageID, nil
+}
+
+// normalizeUsageItem подставляет значения по умолчанию и проверяет запрос. С дедупликацией изображение
+// засчитывается один раз за окно, поэтому count больше 1 отклоняется, а не урезается молча.
+func (s *usageServiceImpl) normalizeUsageItem(item *model.UsageItem) error {
+	if item.Count == 0 {
+		item.Count = 1
+	}
+	if item.Action == "" {
+		item.Action = model.UsageActionInsert
+	}
+	switch {
+	case item.ImageID <= 0:
+		return fmt.Errorf("invalid image_id %d", item.ImageID)
+	case item.Count < 0 || item.Count > MaxUsageCount:
+		return fmt.Errorf("count must be between 1 and %d", MaxUsageCount)
+	case item.Count > 1 && s.dedupWindow > 0:
+		return fmt.Errorf("count must be 1 while usage deduplication is enabled")
+	case !ValidUsageAction(item.Action):
+		return fmt.Errorf("unknown usage action %q", item.Action)
+	}
+	return nil
+}
+
+// RecordImageUsage записывает использование изображения по ID.
+// Ошибки валидации возвращаются в результате со статусом invalid, неизвестное изображение — ErrImageNotFound.
+func (s *usageServiceImpl) RecordImageUsage(licenseUUID string, item model.UsageItem) (model.UsageResult, error) {
+	result := model.UsageResult{ImageID: item.ImageID}
+	if err := s.normalizeUsageItem(&item); err != nil {
+		result.Status = model.UsageStatusInvalid
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	if err := s.checkLicense(licenseUUID); err != nil {
+		return result, err
+	}
+
+	counts, err := s.repo.GetUsageCounts([]int{item.ImageID})
+	if err != nil {
+		log.Printf("Service error recording usage for image %d: %v", item.ImageID, err)
+		return result, err
+	}
+	usageCount, ok := counts[item.ImageID]
+	if !ok {
+		result.Status = model.UsageStatusNotFound
+		return result, ErrImageNotFound
+	}
+
+	claimed, err := s.claim(licenseUUID, []int{item.ImageID})
+	if err != nil {
+		log.Printf("Service error checking duplicate usage of image %d: %v", item.ImageID, err)
+		return result, err
+	}
+
+	result.Status = model.UsageStatusDuplicate
+	if claimed[item.ImageID] {
+		result.Status = model.UsageStatusOK
+		result.Recorded = item.Count
+		s.buffer.Add(item.ImageID, licenseUUID, item.Action, result.Recorded)
+	}
+	// usage_count с учётом ещё не записанных в базу использований
+	result.UsageCount = usageCount + s.buffer.PendingFor(item.ImageID)
+	return result, nil
+}
+
+// RecordUsageBatch записывает использование нескольких изображений и возвращает результат по каждому.
+// Некорректные элементы отмечаются статусом invalid и не мешают записи остальных.
+func (s *usageServiceImpl) RecordUsageBatch(licenseUUID string, items []model.UsageItem) ([]model.UsageResult, error) {
+	if err := s.checkLicense(licenseUUID); err != nil {
+		return nil, err
+	}
+
+	results := make([]model.UsageResult, len(items))
+	ids := make([]int, 0, len(items))
+	for i := range items {
+		if err := s.normalizeUsageItem(&items[i]); err != nil {
+			results[i] = model.UsageResult{ImageID: items[i].ImageID, Status: model.UsageStatusInvalid, Error: err.Error()}
+			continue
+		}
+		ids = append(ids, items[i].ImageID)
+	}
+
+	counts, err := s.repo.GetUsageCounts(ids)
+	if err != nil {
+		log.Printf("Service error recording usage batch of %d items: %v", len(items), err)
+		return nil, err
+	}
+
+	existing := make([]int, 0, len(counts))
+	for _, id := range ids {
+		if _, ok := counts[id]; ok {
+			existing = append(existing, id)
+		}
+	}
+	claimed, err := s.claim(licenseUUID, existing)
+	if err != nil {
+		log.Printf("Service error checking duplicate usage in batch of %d items: %v", len(items), err)
+		return nil, err
+	}
+
+	for i, item := range items {
+		if results[i].Status == model.UsageStatusInvalid {
+			continue
+		}
+		results[i] = model.UsageResult{ImageID: item.ImageID}
+		usageCount, ok := counts[item.ImageID]
+		if !ok {
+			results[i].Status = model.UsageStatusNotFound
+			continue
+		}
+
+		// Одно изображение засчитывается в пакете один раз, остальные его элементы — повторы
+		results[i].Status = model.UsageStatusDuplicate
+		if claimed[item.ImageID] {
+			if s.dedupWindow > 0 {
+				delete(claimed, item.ImageID)
+			}
+			results[i].Status = model.UsageStatusOK
+			results[i].Recorded = item.Count
+			s.buffer.Add(item.ImageID, licenseUUID, item.Action, results[i].Recorded)
+		}
+		results[i].UsageCount = usageCount + s.buffer.PendingFor(item.ImageID)
+	}
+
+	return results, nil
+}
+
+func (s *usageServiceImpl) GetUsageEvents(filter model.UsageEventFilter) ([]model.UsageEvent, int, error) {
+	return s.repo.GetUsageEvents(filter)
+}
+
+func (s *usageServiceImpl) BufferStats() model.UsageBufferStats {
+	return s.buffer.Stats()
+}
+
+// GetSpikeReport собирает изображения и лицензии с резким ростом использования за окно,
+// а также лицензии с большим числом отклонённых повторов за окно (с точностью до часа)
+func (s *usageServiceImpl) GetSpikeReport(params model.UsageSpikeParams) (model.UsageSpikeReport, error) {
+	to := time.Now()
+	report := model.UsageSpikeReport{From: to.Add(-params.Window), To: to}
+
+	images, err := s.repo.GetImageUsageSpikes(to, params)
+	if err != nil {
+		log.Printf("Service error fetching image usage spikes: %v", err)
+		return report, err
+	}
+	licenses, err := s.repo.GetLicenseUsageSpikes(to, params)
+	if err != nil {
+		log.Printf("Service error fetching license usage spikes: %v", err)
+		return report, err
+	}
+
+	s.mu.Lock()
+	report.Duplicates = s.duplicates
+	report.Unlicensed = s.unlicensed
+	seen := make(map[string]bool, len(licenses))
+	for i := range licenses {
+		licenses[i].Duplicates = s.duplicatesSince(licenses[i].LicenseUUID, report.From)
+		seen[licenses[i].LicenseUUID] = true
+	}
+	for uuid := range s.duplicatesByLicense {
+		if n := s.duplicatesSince(uuid, report.From); !seen[uuid] && n >= int64(params.MinEvents) {
+			licenses = append(licenses, model.LicenseUsageSpike{LicenseUUID: uuid, Duplicates: n})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(licenses, func(i, j int) bool {
+		if licenses[i].Ratio != licenses[j].Ratio {
+			return licenses[i].Ratio > licenses[j].Ratio
+		}
+		return licenses[i].Duplicates > licenses[j].Duplicates
+	})
+	if len(licenses) > params.Limit {
+		licenses = licenses[:params.Limit]
+	}
+
+	report.Images = images
+	report.Licenses = licenses
+	return report, nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"log"
+	"sync"
+	"time"
+)
+
+// Если в буфере накопилось столько событий, он сбрасывается, не дожидаясь таймера
+const usageBufferMaxPending = 5000
+
+type usageKey struct {
+	imageID     int
+	licenseUUID string
+	action      string
+}
+
+// UsageBuffer накапливает использования изображений в памяти и периодически записывает их
+// в базу одним запросом. Так популярные изображения не превращаются в точку конкуренции
+// за строку Images на каждом запросе плагина.
+type UsageBuffer struct {
+	repo     *postgres.UsageRepository
+	interval time.Duration
+
+	mu       sync.Mutex
+	pending  map[usageKey]*model.PendingUsage
+	perImage map[int]int
+	total    int
+	stats    model.UsageBufferStats
+
+	// Одновременно выполняется только один сброс
+	flushMu sync.Mutex
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewUsageBuffer(repo *postgres.UsageRepository, interval time.Duration) *UsageBuffer {
+	return &UsageBuffer{
+		repo:     repo,
+		interval: interval,
+		pending:  make(map[usageKey]*model.PendingUsage),
+		perImage: make(map[int]int),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает периодический сброс буфера в отдельной горутине
+func (b *UsageBuffer) Start() {
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-b.kick:
+			case <-b.stop:
+				return
+			}
+			_ = b.Flush()
+		}
+	}()
+}
+
+// Close останавливает периодический сброс и записывает всё, что осталось в буфере
+func (b *UsageBuffer) Close() error {
+	close(b.stop)
+	<-b.done
+	return b.Flush()
+}
+
+// Add добавляет count использований изображения в буфер
+func (b *UsageBuffer) Add(imageID int, licenseUUID, action string, count int) {
+	key := usageKey{imageID: imageID, licenseUUID: licenseUUID, action: action}
+	now := time.Now()
+
+	b.mu.Lock()
+	p, ok := b.pending[key]
+	if !ok {
+		p = &model.PendingUsage{ImageID: imageID, LicenseUUID: licenseUUID, Action: action, FirstSeen: now}
+		b.pending[key] = p
+	}
+	p.Count += count
+	p.LastSeen = now
+	b.perImage[imageID] += count
+	b.total += count
+	full := b.total >= usageBufferMaxPending
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// PendingFor возвращает число ещё не записанных использований изображения
+func (b *UsageBuffer) PendingFor(imageID int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.perImage[imageID]
+}
+
+// PendingForLicense возвращает ещё не записанные использования лицензии
+func (b *UsageBuffer) PendingForLicense(licenseUUID string) []model.PendingUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var pending []model.PendingUsage
+	for key, p := range b.pending {
+		if key.licenseUUID == licenseUUID {
+			pending = append(pending, *p)
+		}
+	}
+	return pending
+}
+
+// Flush записывает накопленные события. При ошибке события возвращаются в буфер
+// и будут записаны при следующем сбросе.
+func (b *UsageBuffer) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	if b.total == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	batch := make([]model.PendingUsage, 0, len(b.pending))
+	for _, p := range b.pending {
+		batch = append(batch, *p)
+	}
+	batchTotal := b.total
+	b.pending = make(map[usageKey]*model.PendingUsage)
+	b.perImage = make(map[int]int)
+	b.total = 0
+	b.mu.Unlock()
+
+	inserted, err := b.repo.InsertUsageEvents(batch)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.LastFlushAt = time.Now()
+	if err != nil {
+		for _, p := range batch {
+			key := usageKey{imageID: p.ImageID, licenseUUID: p.LicenseUUID, action: p.Action}
+			if existing, ok := b.pending[key]; ok {
+				existing.Count += p.Count
+				if p.FirstSeen.Before(existing.FirstSeen) {
+					existing.FirstSeen = p.FirstSeen
+				}
+				if p.LastSeen.After(existing.LastSeen) {
+					existing.LastSeen = p.LastSeen
+				}
+			} else {
+				restored := p
+				b.pending[key] = &restored
+			}
+			b.perImage[p.ImageID] += p.Count
+			b.total += p.Count
+		}
+		b.stats.FailedFlushes++
+		b.stats.LastFlushError = err.Error()
+		log.Printf("UsageBuffer: failed to flush %d usage events, will retry: %v", batchTotal, err)
+		return err
+	}
+
+	b.stats.Flushes++
+	b.stats.FlushedEvents += int64(inserted)
+	b.stats.DroppedEvents += int64(batchTotal - inserted)
+	b.stats.LastFlushError = ""
+	return nil
+}
+
+// Stats возвращает счётчики буфера
+func (b *UsageBuffer) Stats() model.UsageBufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.PendingEvents = b.total
+	return stats
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"HorizonBackend/internal/model"
+	"HorizonBackend/internal/repository/postgres"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidReportLevel = errors.New("level must be one of family, group, subgroup, image")
+
+type UsageReportService interface {
+	GetUsageReport(level, family string, from, to time.Time) ([]model.UsageReportRow, error)
+}
+
+type usageReportServiceImpl struct {
+	repo *postgres.UsageRepository
+}
+
+func NewUsageReportService(repo *postgres.UsageRepository) UsageReportService {
+	return &usageReportServiceImpl{repo: repo}
+}
+
+// ValidUsageReportLevel проверяет уровень агрегации отчёта
+func ValidUsageReportLevel(level string) bool {
+	switch level {
+	case model.UsageReportFamily, model.UsageReportGroup, model.UsageReportSubgroup, model.UsageReportImage:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetUsageReport возвращает использование за [from, to), включая изображения без использований
+func (s *usageReportServiceImpl) GetUsageReport(level, family string, from, to time.Time) ([]model.UsageReportRow, error) {
+	if !ValidUsageReportLevel(level) {
+		return nil, ErrInvalidReportLevel
+	}
+
+	report, err := s.repo.GetUsageReport(level, family, from, to)
+	if err != nil {
+		log.Printf("Service error building usage report by %s from %s to %s: %v", level, from.Format("2006-01-02"), to.Format("2006-01-02"), err)
+		return nil, err
+	}
+	return report, nil
+}
+
+// WriteUsageReportCSV пишет отчёт в CSV с заголовком; колонки ниже уровня отчёта не выводятся
+func WriteUsageReportCSV(w io.Writer, level string, rows []model.UsageReportRow) error {
+	header := []string{"family"}
+	switch level {
+	case model.UsageReportGroup:
+		header = append(header, "group")
+	case model.UsageReportSubgroup:
+		header = append(header, "group", "subgroup")
+	case model.UsageReportImage:
+		header = append(header, "group", "subgroup", "image_id", "file_path")
+	}
+	header = append(header, "images", "used_images", "events", "inserts", "replaces", "licenses")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := []string{row.Family}
+		switch level {
+		case model.UsageReportGroup:
+			record = append(record, row.Group)
+		case model.UsageReportSubgroup:
+			record = append(record, row.Group, row.Subgroup)
+		case model.UsageReportImage:
+			record = append(record, row.Group, row.Subgroup, strconv.Itoa(row.ImageID), row.FilePath)
+		}
+		record = append(record,
+			strconv.Itoa(row.Images),
+			strconv.Itoa(row.UsedImages),
+			strconv.Itoa(row.Events),
+			strconv.Itoa(row.Inserts),
+			strconv.Itoa(row.Replaces),
+			strconv.Itoa(row.Licenses),
+		)
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,125 @@
+package suggest
+
+import (
+	"HorizonBackend/internal/model"
+	"sort"
+	"strings"
+)
+
+// entry — термин в индексе; hits хранятся по семействам, чтобы отвечать и с фильтром, и без
+type entry struct {
+	text  string
+	kind  string
+	hits  map[string]int
+	total int
+}
+
+type node struct {
+	children map[rune]*node
+	entries  []*entry
+}
+
+// Trie — неизменяемый после построения префиксный индекс терминов для автодополнения.
+// Для обновления строится новый Trie и целиком подменяет старый.
+type Trie struct {
+	root  *node
+	terms map[string]*entry
+}
+
+func NewTrie() *Trie {
+	return &Trie{root: &node{}, terms: make(map[string]*entry)}
+}
+
+// Normalize приводит текст к виду, в котором он хранится в индексе
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// Add добавляет совпадения термина в семействе. Повторное добавление суммирует hits.
+func (t *Trie) Add(src model.SuggestionSource) {
+	key := Normalize(src.Text)
+	if key == "" || src.Hits <= 0 {
+		return
+	}
+
+	termKey := src.Type + "\x00" + key
+	e, ok := t.terms[termKey]
+	if !ok {
+		e = &entry{text: key, kind: src.Type, hits: make(map[string]int)}
+		t.terms[termKey] = e
+
+		n := t.root
+		for _, r := range key {
+			if n.children == nil {
+				n.children = make(map[rune]*node)
+			}
+			child, ok := n.children[r]
+			if !ok {
+				child = &node{}
+				n.children[r] = child
+			}
+			n = child
+		}
+		n.entries = append(n.entries, e)
+	}
+
+	e.hits[src.Family] += src.Hits
+	e.total += src.Hits
+}
+
+// Suggest возвращает до limit терминов, начинающихся с prefix, по убыванию числа совпадений.
+// Пустой family означает все семейства.
+func (t *Trie) Suggest(prefix, family string, limit int) []model.Suggestion {
+	prefix = Normalize(prefix)
+	if prefix == "" || limit <= 0 {
+		return []model.Suggestion{}
+	}
+
+	n := t.root
+	for _, r := range prefix {
+		n = n.children[r]
+		if n == nil {
+			return []model.Suggestion{}
+		}
+	}
+
+	var result []model.Suggestion
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, e := range n.entries {
+			hits := e.total
+			if family != "" {
+				hits = e.hits[family]
+			}
+			if hits > 0 {
+				result = append(result, model.Suggestion{Text: e.text, Type: e.kind, Hits: hits})
+			}
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Hits != result[j].Hits {
+			return result[i].Hits > result[j].Hits
+		}
+		if result[i].Text != result[j].Text {
+			return result[i].Text < result[j].Text
+		}
+		return result[i].Type < result[j].Type
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	if result == nil {
+		result = []model.Suggestion{}
+	}
+	return result
+}
+
+// Len возвращает число терминов в индексе
+func (t *Trie) Len() int {
+	return len(t.terms)
+}
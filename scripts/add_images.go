@@ -1,252 +1,312 @@
 package scripts
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
-	"log"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/nfnt/resize"
+	"github.com/lib/pq"
 )
 
-func compressImage(inputPath string, outputPath string) error {
-	fmt.Println("Processing:", inputPath)
-	file, err := os.Open(inputPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	img, format, err := image.Decode(file)
+// applyCatalog приводит базу к состоянию disk в одной транзакции: удаляет изображения, добавляет
+// таксономию, записывает изображения и удаляет опустевшую таксономию. Каждый файл обрабатывается
+// в своей точке сохранения: при ContinueOnError ошибка файла откатывает только его, иначе — всю загрузку.
+// fileErrors — ошибки хэширования и создания миниатюр по ключу изображения; такие файлы не записываются.
+// Отмена ctx откатывает транзакцию.
+func applyCatalog(ctx context.Context, db *sql.DB, baseFolder string, disk *catalog, diff *CatalogDiff, fileErrors map[string]*FileError, opts IngestOptions, report *IngestReport) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if format != "jpeg" && format != "png" {
-		return fmt.Errorf("unsupported format for file: %s", inputPath)
+	if len(diff.RemovedImages) > 0 {
+		keys := make([]string, len(diff.RemovedImages))
+		for i, c := range diff.RemovedImages {
+			keys[i] = c.Key
+		}
+		res, err := tx.Exec(`
+			DELETE FROM Images i
+			USING Subgroups s, Groups g, Families f
+			WHERE i.subgroup_id = s.id AND s.group_id = g.id AND g.family_id = f.id
+			AND f.name || '/' || g.name || '/' || s.name || '/' || i.name = ANY($1)`, pq.Array(keys))
+		if err != nil {
+			return fmt.Errorf("delete removed images: %w", err)
+		}
+		removed, _ := res.RowsAffected()
+		report.Removed = int(removed)
 	}
 
-	m := resize.Resize(100, 100, img, resize.Lanczos3)
-
-	out, err := os.Create(outputPath)
-	if err != nil {
+	if err := addTaxonomy(tx, diff); err != nil {
 		return err
 	}
-	defer out.Close()
 
-	if filepath.Ext(inputPath) == ".jpg" || filepath.Ext(inputPath) == ".jpeg" {
-		err = jpeg.Encode(out, m, nil)
-	} else if filepath.Ext(inputPath) == ".png" {
-		err = png.Encode(out, m)
+	added := make(map[string]bool, len(diff.AddedImages))
+	for _, c := range diff.AddedImages {
+		added[c.Key] = true
 	}
-
-	return err
-}
-
-func toInterfaceSlice(slice []int) []interface{} {
-	s := make([]interface{}, len(slice))
-	for i, v := range slice {
-		s[i] = v
+	updated := make(map[string]bool, len(diff.UpdatedImages))
+	for _, c := range diff.UpdatedImages {
+		updated[c.Key] = true
 	}
-	return s
-}
 
-func getFilePathFromDB(db *sql.DB, imageID int) string {
-	var filePath string
+	for _, key := range sortedKeys(disk.Images) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		img := disk.Images[key]
+		if opts.Verbose {
+			fmt.Printf("Processing image: %s\n", key)
+		}
 
-	// запрос SQL для извлечения пути файла по ID
-	query := `SELECT file_path FROM images WHERE id = $1`
+		if _, err := tx.Exec(`SAVEPOINT ingest_file`); err != nil {
+			return err
+		}
+		var err error
+		if fileErr := fileErrors[key]; fileErr != nil {
+			err = fileErr
+		} else {
+			_, err = processImage(tx, baseFolder, img, opts.Renditions, report)
+		}
+		if err != nil {
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) {
+				return err
+			}
+			report.Errors = append(report.Errors, *fileErr)
+			if !opts.ContinueOnError {
+				return err
+			}
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT ingest_file`); err != nil {
+				return err
+			}
+			report.Failed++
+			continue
+		}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT ingest_file`); err != nil {
+			return err
+		}
 
-	err := db.QueryRow(query, imageID).Scan(&filePath)
-	if err != nil {
-		log.Printf("Error retrieving file path for ID %d: %v\n", imageID, err)
-		return ""
+		switch {
+		case added[key]:
+			report.Added++
+		case updated[key]:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
 	}
 
-	return filePath
+	if err := removeTaxonomy(tx, diff); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func AddImagesFromFolder(db *sql.DB, baseFolder string) {
+// contentChanged — условие ON CONFLICT: хэш файла изображения или миниатюры отличается от записанного.
+// Пустой хэш в базе (изображение загружено до его появления) изменением не считается.
+const contentChanged = `((Images.source_hash IS NOT NULL AND Images.source_hash != excluded.source_hash)
+	OR (Images.thumb_hash IS NOT NULL AND Images.thumb_hash != excluded.thumb_hash))`
 
-	tx, err := db.Begin()
-	if err != nil {
-		panic(err)
+// sortedKeys возвращает ключи m по возрастанию
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	defer tx.Rollback()
+	sort.Strings(keys)
+	return keys
+}
 
-	fmt.Println("Step 1: Checking for file existence.")
-	rows, err := db.Query(`SELECT id, file_path FROM Images`)
-	if err != nil {
-		panic(err)
+// addTaxonomy добавляет новые семейства, группы и подгруппы
+func addTaxonomy(tx *sql.Tx, diff *CatalogDiff) error {
+	for _, family := range diff.AddedFamilies {
+		if _, err := tx.Exec(`INSERT INTO Families (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, family); err != nil {
+			return fmt.Errorf("add family %s: %w", family, err)
+		}
 	}
-	defer rows.Close()
-
-	var idsToDelete []int
-	for rows.Next() {
-		var id int
-		var filePath string
-		if err := rows.Scan(&id, &filePath); err != nil {
-			fmt.Printf("Error scanning row: %v\n", err)
-			continue
+	for _, key := range diff.AddedGroups {
+		parts := strings.SplitN(key, "/", 2)
+		_, err := tx.Exec(`
+			INSERT INTO Groups (name, family_id)
+			VALUES ($1, (SELECT id FROM Families WHERE name = $2))
+			ON CONFLICT (family_id, name) DO NOTHING`, parts[1], parts[0])
+		if err != nil {
+			return fmt.Errorf("add group %s: %w", key, err)
 		}
-
-		absolutePath := filePath
-		if _, err := os.Stat(absolutePath); os.IsNotExist(err) {
-			fmt.Printf("Marking ID: %d, FilePath: %s for deletion. AbsolutePath: %s. Error: %v\n",
-				id, filePath, absolutePath, err)
-			idsToDelete = append(idsToDelete, id)
-		} else if err != nil {
-			fmt.Printf("Error checking file existence, ID: %d, FilePath: %s, AbsolutePath: %s. Error: %v\n",
-				id, filePath, absolutePath, err)
+	}
+	for _, key := range diff.AddedSubgroups {
+		parts := strings.SplitN(key, "/", 3)
+		_, err := tx.Exec(`
+			INSERT INTO Subgroups (name, group_id)
+			VALUES ($1, (SELECT id FROM Groups WHERE name = $2 AND family_id = (SELECT id FROM Families WHERE name = $3)))
+			ON CONFLICT (group_id, name) DO NOTHING`, parts[2], parts[1], parts[0])
+		if err != nil {
+			return fmt.Errorf("add subgroup %s: %w", key, err)
 		}
 	}
-	for _, idToDelete := range idsToDelete {
-		filePath := getFilePathFromDB(db, idToDelete)
-		fmt.Printf("Deleting entry with ID: %d, FilePath: %s\n", idToDelete, filePath)
+	return nil
+}
 
+// removeTaxonomy удаляет подгруппы, группы и семейства, которых нет на диске и в которых не осталось изображений
+func removeTaxonomy(tx *sql.Tx, diff *CatalogDiff) error {
+	if len(diff.RemovedSubgroups) > 0 {
+		_, err := tx.Exec(`
+			DELETE FROM Subgroups s
+			USING Groups g, Families f
+			WHERE s.group_id = g.id AND g.family_id = f.id
+			AND f.name || '/' || g.name || '/' || s.name = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM Images i WHERE i.subgroup_id = s.id)`, pq.Array(diff.RemovedSubgroups))
+		if err != nil {
+			return fmt.Errorf("delete removed subgroups: %w", err)
+		}
 	}
-
-	// Удаляем записи, которых нет на диске
-
-	if len(idsToDelete) > 0 {
-		fmt.Printf("Deleting %d Image entries as files do not exist on disk.\n", len(idsToDelete))
-
-		idsStr := ""
-		for i := range idsToDelete {
-			idsStr += fmt.Sprintf("$%d,", i+1)
+	if len(diff.RemovedGroups) > 0 {
+		_, err := tx.Exec(`
+			DELETE FROM Groups g
+			USING Families f
+			WHERE g.family_id = f.id
+			AND f.name || '/' || g.name = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM Subgroups s WHERE s.group_id = g.id)`, pq.Array(diff.RemovedGroups))
+		if err != nil {
+			return fmt.Errorf("delete removed groups: %w", err)
 		}
-		idsStr = strings.TrimSuffix(idsStr, ",")
-
-		query := "DELETE FROM Images WHERE id IN (" + idsStr + ")"
-		_, err = db.Exec(query, toInterfaceSlice(idsToDelete)...)
+	}
+	if len(diff.RemovedFamilies) > 0 {
+		_, err := tx.Exec(`
+			DELETE FROM Families f
+			WHERE f.name = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM Groups g WHERE g.family_id = f.id)`, pq.Array(diff.RemovedFamilies))
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("delete removed families: %w", err)
 		}
-	} else {
-		fmt.Println("No Image entries need deletion.")
 	}
+	return nil
+}
 
-	fmt.Println("Step 2: Adding new files.")
+// processImage записывает изображение, при необходимости анализирует его и возвращает его ID.
+// Миниатюры к этому моменту уже созданы. Ошибки, относящиеся к файлу, возвращаются как *FileError; ошибка анализа не мешает записи.
+// version растёт, когда меняется хэш файла изображения или любой из миниатюр, updated_at — при любом изменении.
+func processImage(tx *sql.Tx, baseFolder string, img catalogImage, renditions []Rendition, report *IngestReport) (int, error) {
+	originalFilePath := img.sourcePath(baseFolder)
 
-	familyDirs, err := os.ReadDir(baseFolder)
+	thumb, err := currentState(img.thumbFilePath(baseFolder), img.Thumb)
 	if err != nil {
-		panic(err)
+		return 0, &FileError{Path: img.thumbFilePath(baseFolder), Stage: StageThumbnail, Err: err.Error()}
+	}
+	stored, renditionsChanged, err := currentRenditions(baseFolder, img, renditions)
+	if err != nil {
+		return 0, err
 	}
 
-	for _, familyDir := range familyDirs {
-		fmt.Printf("Processing family: %s\n", familyDir.Name())
-		if !familyDir.IsDir() {
-			continue
-		}
-		familyName := familyDir.Name()
-
-		_, err := tx.Exec(`INSERT INTO Families (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, familyName)
-		if err != nil {
-			panic(err)
-		}
+	var imageID int
+	err = tx.QueryRow(`
+		INSERT INTO Images (name, file_path, thumb_path, subgroup_id, meta_tags, title, description, author, license,
+			source_hash, source_size, source_mtime, thumb_hash, thumb_size, thumb_mtime, format)
+		VALUES ($1, $2, $3, (SELECT s.id FROM Subgroups s
+							 JOIN Groups g ON s.group_id = g.id
+							 WHERE s.name = $4 AND g.name = $5 AND g.family_id = (SELECT id FROM Families WHERE name = $6) LIMIT 1),
+				$7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $19)
+		ON CONFLICT (name, subgroup_id)
+		DO UPDATE SET file_path = excluded.file_path, thumb_path = excluded.thumb_path,
+					  meta_tags = excluded.meta_tags, title = excluded.title, description = excluded.description,
+					  author = excluded.author, license = excluded.license,
+					  source_hash = excluded.source_hash, source_size = excluded.source_size, source_mtime = excluded.source_mtime,
+					  thumb_hash = excluded.thumb_hash, thumb_size = excluded.thumb_size, thumb_mtime = excluded.thumb_mtime,
+					  format = excluded.format,
+					  version = Images.version + CASE WHEN `+contentChanged+` OR $18 THEN 1 ELSE 0 END,
+					  updated_at = CASE WHEN `+contentChanged+` OR $18
+					      OR (Images.file_path, Images.thumb_path, Images.meta_tags, Images.title,
+					          Images.description, Images.author, Images.license)
+					      IS DISTINCT FROM (excluded.file_path, excluded.thumb_path, excluded.meta_tags, excluded.title,
+					          excluded.description, excluded.author, excluded.license)
+					      THEN now() ELSE Images.updated_at END
+		RETURNING id`,
+		img.Name, img.FilePath, img.ThumbPath, img.Subgroup, img.Group, img.Family,
+		pq.Array(img.Meta.Tags), img.Meta.Title, img.Meta.Description, img.Meta.Author, img.Meta.License,
+		img.Source.Hash, img.Source.Size, img.Source.ModTime, thumb.Hash, thumb.Size, thumb.ModTime, renditionsChanged, img.Format).Scan(&imageID)
+	if err != nil {
+		return 0, &FileError{Path: originalFilePath, Stage: StageUpsert, Err: err.Error()}
+	}
+	if err := storeRenditions(tx, imageID, stored); err != nil {
+		return 0, &FileError{Path: originalFilePath, Stage: StageUpsert, Err: err.Error()}
+	}
 
-		groupDirs, err := os.ReadDir(filepath.Join(baseFolder, familyName))
-		if err != nil {
-			panic(err)
-		}
+	// Размеры и палитру считаем один раз и заново — только при замене файла: декодирование полноразмерных файлов дорогое
+	analyzed, err := isAnalyzed(tx, imageID)
+	if err != nil {
+		return 0, &FileError{Path: originalFilePath, Stage: StageAnalyze, Err: err.Error()}
+	}
+	if analyzed && !img.SourceChanged {
+		return imageID, nil
+	}
 
-		for _, groupDir := range groupDirs {
-			fmt.Printf("Processing group: %s\n", groupDir.Name())
-			if !groupDir.IsDir() {
-				continue
-			}
-			groupName := groupDir.Name()
+	analysis, err := analyzeImage(originalFilePath)
+	if err != nil {
+		report.Errors = append(report.Errors, FileError{Path: originalFilePath, Stage: StageAnalyze, Err: err.Error(), Warning: true})
+		return imageID, nil
+	}
+	if err := storeAnalysis(tx, imageID, analysis); err != nil {
+		return 0, &FileError{Path: originalFilePath, Stage: StageAnalyze, Err: err.Error()}
+	}
+	report.Analyzed++
+	return imageID, nil
+}
 
-			_, err := tx.Exec(`
-                INSERT INTO Groups (name, family_id) 
-                VALUES ($1, (SELECT id FROM Families WHERE name = $2)) 
-                ON CONFLICT (family_id, name) DO NOTHING`, groupName, familyName)
-			if err != nil {
-				panic(err)
-			}
+// currentRenditions читает размеры и хэши созданных миниатюр renditions. changed — хэш одной из
+// миниатюр, уже записанных в базу, изменился.
+func currentRenditions(baseFolder string, img catalogImage, renditions []Rendition) ([]storedRendition, bool, error) {
+	result := make([]storedRendition, 0, len(renditions))
+	changed := false
+	for _, r := range renditions {
+		path := img.renditionFilePath(baseFolder, r.Name)
+		prev, ok := img.Renditions[r.Name]
 
-			subgroupDirs, err := os.ReadDir(filepath.Join(baseFolder, familyName, groupName))
+		state, err := currentState(path, prev.File)
+		if err != nil {
+			return nil, false, &FileError{Path: path, Stage: StageThumbnail, Err: err.Error()}
+		}
+		current := storedRendition{Rendition: r, Path: img.renditionPath(r.Name), File: state}
+		if ok && prev.File.Hash == state.Hash {
+			current.Width, current.Height = prev.Width, prev.Height
+		} else {
+			cfg, err := decodeConfig(path)
 			if err != nil {
-				panic(err)
-			}
-
-			for _, subgroupDir := range subgroupDirs {
-				fmt.Printf("Processing subgroup: %s\n", subgroupDir.Name())
-
-				if !subgroupDir.IsDir() {
-					continue
-				}
-				subgroupName := subgroupDir.Name()
-
-				_, err := tx.Exec(`
-                    INSERT INTO Subgroups (name, group_id) 
-                    VALUES ($1, (SELECT id FROM Groups WHERE name = $2 AND family_id = (SELECT id FROM Families WHERE name = $3)))
-                    ON CONFLICT (group_id, name) DO NOTHING`, subgroupName, groupName, familyName)
-				if err != nil {
-					panic(err)
-				}
-
-				imageFiles, err := os.ReadDir(filepath.Join(baseFolder, familyName, groupName, subgroupName))
-				if err != nil {
-					panic(err)
-				}
-
-				for _, imageFile := range imageFiles {
-					fmt.Printf("Processing image file: %s\n", imageFile.Name())
-
-					if imageFile.IsDir() {
-						continue
-					}
-					imageName := strings.TrimSuffix(imageFile.Name(), filepath.Ext(imageFile.Name()))
-
-					if strings.Contains(imageName, "_thumb") {
-						continue
-					}
-
-					imagePath := filepath.Join("static", "images", familyName, groupName, subgroupName, imageFile.Name())
-					thumbPath := ""
-
-					if familyName == "Frames" {
-						thumbPath = imagePath
-					} else {
-						thumbPath = filepath.Join("static", "images", familyName, groupName, subgroupName, imageName+"_thumb"+filepath.Ext(imageFile.Name()))
-						originalFilePath := filepath.Join(baseFolder, familyName, groupName, subgroupName, imageFile.Name())
-						thumbFilePath := filepath.Join(baseFolder, familyName, groupName, subgroupName, imageName+"_thumb"+filepath.Ext(imageFile.Name()))
-						if _, err := os.Stat(thumbFilePath); os.IsNotExist(err) {
-							err = compressImage(originalFilePath, thumbFilePath)
-							if err != nil {
-								panic(err)
-							}
-						}
-					}
-
-					_, err := tx.Exec(`
-						INSERT INTO Images (name, file_path, thumb_path, subgroup_id)
-						VALUES ($1, $2, $3, (SELECT s.id FROM Subgroups s
-											 JOIN Groups g ON s.group_id = g.id
-											 WHERE s.name = $4 AND g.name = $5 AND g.family_id = (SELECT id FROM Families WHERE name = $6) LIMIT 1))
-						ON CONFLICT (name, subgroup_id)
-						DO UPDATE SET file_path = excluded.file_path, thumb_path = excluded.thumb_path`,
-						imageName, imagePath, thumbPath, subgroupName, groupName, familyName)
-					if err != nil {
-						fmt.Printf("Error inserting/updating image: %s\n", err.Error())
-						panic(err)
-					} else {
-						fmt.Printf("Image [%s] processed successfully.\n", imageName)
-					}
-
-				}
+				return nil, false, &FileError{Path: path, Stage: StageThumbnail, Err: err.Error()}
 			}
+			current.Width, current.Height = cfg.Width, cfg.Height
+			changed = changed || ok
 		}
+		result = append(result, current)
 	}
+	return result, changed, nil
+}
 
-	err = tx.Commit()
-	if err != nil {
-		panic(err)
+// storeRenditions записывает миниатюры изображения и удаляет те, которых больше нет в настройках
+func storeRenditions(tx *sql.Tx, imageID int, renditions []storedRendition) error {
+	names := make([]string, len(renditions))
+	for i, r := range renditions {
+		names[i] = r.Name
+	}
+	if _, err := tx.Exec(`DELETE FROM image_renditions WHERE image_id = $1 AND NOT (name = ANY($2))`, imageID, pq.Array(names)); err != nil {
+		return err
+	}
+
+	for _, r := range renditions {
+		_, err := tx.Exec(`
+			INSERT INTO image_renditions (image_id, name, path, max_size, crop, width, height, hash, size, mtime)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (image_id, name) DO UPDATE SET path = excluded.path, max_size = excluded.max_size,
+				crop = excluded.crop, width = excluded.width, height = excluded.height,
+				hash = excluded.hash, size = excluded.size, mtime = excluded.mtime`,
+			imageID, r.Name, r.Path, r.Size, r.Crop, r.Width, r.Height, r.File.Hash, r.File.Size, r.File.ModTime)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,187 @@
+package scripts
+
+import (
+	"HorizonBackend/internal/palette"
+	"HorizonBackend/internal/phash"
+	"database/sql"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Сколько доминирующих цветов сохраняем для каждого изображения
+const paletteSize = 5
+
+// imageAnalysis — всё, что мы узнаём об изображении за одно декодирование
+type imageAnalysis struct {
+	Width    int
+	Height   int
+	BitDepth int
+	HasAlpha bool
+	// GIF с несколькими кадрами; анализируется первый кадр
+	Animated bool
+	Palette  []palette.Swatch
+	// Перцептивный хэш считается только для растровых изображений
+	Hash *phash.Hash
+}
+
+func (a *imageAnalysis) aspectRatio() float64 {
+	if a.Height == 0 {
+		return 0
+	}
+	return float64(a.Width) / float64(a.Height)
+}
+
+// analyzeImage считает размеры, глубину цвета, прозрачность и палитру файла.
+// Для SVG размеры берутся из viewBox, а палитра — из цветов заливки.
+func analyzeImage(path string) (*imageAnalysis, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".svg" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		width, height := svgSize(data)
+		return &imageAnalysis{
+			Width:  width,
+			Height: height,
+			// У векторной рамки нет собственного фона
+			HasAlpha: true,
+			Palette:  palette.FromSVG(data, paletteSize),
+		}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var img image.Image
+	animated := false
+	if strings.ToLower(filepath.Ext(path)) == ".gif" {
+		g, err := gif.DecodeAll(file)
+		if err != nil {
+			return nil, err
+		}
+		img, animated = g.Image[0], len(g.Image) > 1
+	} else if img, _, err = image.Decode(file); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	hash := phash.Compute(img)
+	return &imageAnalysis{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		BitDepth: bitDepth(img.ColorModel()),
+		HasAlpha: hasTransparency(img),
+		Animated: animated,
+		Palette:  palette.FromImage(img, paletteSize),
+		Hash:     &hash,
+	}, nil
+}
+
+// bitDepth возвращает число бит на канал для модели цвета
+func bitDepth(model color.Model) int {
+	switch model {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model, color.Alpha16Model:
+		return 16
+	default:
+		return 8
+	}
+}
+
+// hasTransparency проверяет, есть ли в изображении хотя бы один не полностью непрозрачный пиксель
+func hasTransparency(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.YCbCrModel, color.GrayModel, color.Gray16Model, color.CMYKModel:
+		return false
+	}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	svgViewBox    = regexp.MustCompile(`viewBox\s*=\s*["']\s*([-\d.eE]+)[\s,]+([-\d.eE]+)[\s,]+([\d.eE]+)[\s,]+([\d.eE]+)\s*["']`)
+	svgWidthAttr  = regexp.MustCompile(`<svg[^>]*?\swidth\s*=\s*["']([\d.]+)(?:px)?["']`)
+	svgHeightAttr = regexp.MustCompile(`<svg[^>]*?\sheight\s*=\s*["']([\d.]+)(?:px)?["']`)
+)
+
+// svgSize возвращает размеры SVG из viewBox, а при его отсутствии — из атрибутов width/height
+func svgSize(data []byte) (int, int) {
+	if m := svgViewBox.FindSubmatch(data); m != nil {
+		width, errW := strconv.ParseFloat(string(m[3]), 64)
+		height, errH := strconv.ParseFloat(string(m[4]), 64)
+		if errW == nil && errH == nil {
+			return int(width + 0.5), int(height + 0.5)
+		}
+	}
+
+	var width, height float64
+	if m := svgWidthAttr.FindSubmatch(data); m != nil {
+		width, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	if m := svgHeightAttr.FindSubmatch(data); m != nil {
+		height, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	return int(width + 0.5), int(height + 0.5)
+}
+
+// isAnalyzed сообщает, считали ли мы уже размеры, палитру и хэши изображения
+func isAnalyzed(tx *sql.Tx, imageID int) (bool, error) {
+	var analyzed bool
+	err := tx.QueryRow(`
+		SELECT i.width > 0
+			AND EXISTS (SELECT 1 FROM image_colors c WHERE c.image_id = i.id)
+			AND (i.phash IS NOT NULL OR i.file_path ILIKE '%.svg')
+		FROM Images i WHERE i.id = $1`, imageID).Scan(&analyzed)
+	return analyzed, err
+}
+
+func storeAnalysis(tx *sql.Tx, imageID int, a *imageAnalysis) error {
+	var pHash, dHash sql.NullInt64
+	if a.Hash != nil {
+		// BIGINT знаковый: храним биты хэша как есть
+		pHash = sql.NullInt64{Int64: int64(a.Hash.PHash), Valid: true}
+		dHash = sql.NullInt64{Int64: int64(a.Hash.DHash), Valid: true}
+	}
+
+	_, err := tx.Exec(`
+		UPDATE Images SET width = $2, height = $3, aspect_ratio = $4, bit_depth = $5, has_alpha = $6,
+			phash = $7, dhash = $8, animated = $9
+		WHERE id = $1`,
+		imageID, a.Width, a.Height, a.aspectRatio(), a.BitDepth, a.HasAlpha, pHash, dHash, a.Animated)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM image_colors WHERE image_id = $1`, imageID); err != nil {
+		return err
+	}
+	for i, sw := range a.Palette {
+		_, err := tx.Exec(`
+			INSERT INTO image_colors (image_id, position, hex, l, a, b, weight)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			imageID, i, sw.Color.Hex(), sw.Color.Lab.L, sw.Color.Lab.A, sw.Color.Lab.B, sw.Weight)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package scripts
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// catalogImage — изображение в каталоге: найденное на диске или уже записанное в базу
+type catalogImage struct {
+	Family   string
+	Group    string
+	Subgroup string
+	Name     string
+	// Пути в том виде, в котором они хранятся в Images (static/images/...)
+	FilePath  string
+	ThumbPath string
+	// Формат файла изображения: jpeg, png, gif, webp, tiff, bmp или svg
+	Format string
+	Meta   Sidecar
+	// Содержимое файлов изображения и миниатюры
+	Source fileState
+	Thumb  fileState
+	// Миниатюры разных размеров по имени, записанные в базу при прошлой загрузке
+	Renditions map[string]storedRendition
+	// Файл изображения заменён с прошлой загрузки
+	SourceChanged bool
+}
+
+func (img catalogImage) key() string {
+	return img.Family + "/" + img.Group + "/" + img.Subgroup + "/" + img.Name
+}
+
+// sourcePath возвращает путь к файлу изображения внутри baseFolder
+func (img catalogImage) sourcePath(baseFolder string) string {
+	return filepath.Join(baseFolder, img.Family, img.Group, img.Subgroup, filepath.Base(img.FilePath))
+}
+
+// thumbFilePath возвращает путь к файлу миниатюры внутри baseFolder
+func (img catalogImage) thumbFilePath(baseFolder string) string {
+	return filepath.Join(baseFolder, img.Family, img.Group, img.Subgroup, filepath.Base(img.ThumbPath))
+}
+
+// catalog — состояние каталога: изображения и таксономия (семейства, группы, подгруппы)
+type catalog struct {
+	Images    map[string]catalogImage
+	Families  map[string]bool
+	Groups    map[string]bool
+	Subgroups map[string]bool
+	// Ошибки разбора sidecar-файлов, найденные при сканировании папки
+	InvalidSidecars []error
+	// Файлы, которые не удалось распознать как изображения; они не загружаются
+	Unsupported []FileError
+}
+
+func newCatalog() *catalog {
+	return &catalog{
+		Images:    make(map[string]catalogImage),
+		Families:  make(map[string]bool),
+		Groups:    make(map[string]bool),
+		Subgroups: make(map[string]bool),
+	}
+}
+
+// thumbName возвращает имя файла миниатюры для изображения fileName
+func thumbName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "_thumb" + thumbExt(fileName)
+}
+
+// thumbExt возвращает расширение миниатюр изображения fileName: JPEG и PNG сохраняются как есть,
+// остальные форматы (в том числе растеризованный SVG) — в PNG
+func thumbExt(fileName string) string {
+	ext := filepath.Ext(fileName)
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png":
+		return ext
+	default:
+		return ".png"
+	}
+}
+
+// scanCatalog читает структуру baseFolder/{family}/{group}/{subgroup}/{image} и sidecar-файлы.
+// Файлы на диске не меняются.
+func scanCatalog(baseFolder string) (*catalog, error) {
+	c := newCatalog()
+
+	familyDirs, err := os.ReadDir(baseFolder)
+	if err != nil {
+		return nil, err
+	}
+	for _, familyDir := range familyDirs {
+		if !familyDir.IsDir() {
+			continue
+		}
+		familyName := familyDir.Name()
+		c.Families[familyName] = true
+
+		groupDirs, err := os.ReadDir(filepath.Join(baseFolder, familyName))
+		if err != nil {
+			return nil, err
+		}
+		for _, groupDir := range groupDirs {
+			if !groupDir.IsDir() {
+				continue
+			}
+			groupName := groupDir.Name()
+			c.Groups[familyName+"/"+groupName] = true
+
+			subgroupDirs, err := os.ReadDir(filepath.Join(baseFolder, familyName, groupName))
+			if err != nil {
+				return nil, err
+			}
+			for _, subgroupDir := range subgroupDirs {
+				if !subgroupDir.IsDir() {
+					continue
+				}
+				subgroupName := subgroupDir.Name()
+				subgroupPath := filepath.Join(baseFolder, familyName, groupName, subgroupName)
+				c.Subgroups[familyName+"/"+groupName+"/"+subgroupName] = true
+
+				imageFiles, err := os.ReadDir(subgroupPath)
+				if err != nil {
+					return nil, err
+				}
+
+				var subgroupMeta *Sidecar
+				if metaPath := findSidecar(subgroupPath, subgroupMetaName); metaPath != "" {
+					subgroupMeta, err = loadSidecar(metaPath)
+					if err != nil {
+						c.InvalidSidecars = append(c.InvalidSidecars, err)
+					}
+				}
+
+				for _, imageFile := range imageFiles {
+					// Скрытые файлы (в том числе временные файлы миниатюр) не загружаются
+					if imageFile.IsDir() || strings.HasPrefix(imageFile.Name(), ".") {
+						continue
+					}
+					imageName := strings.TrimSuffix(imageFile.Name(), filepath.Ext(imageFile.Name()))
+					if strings.Contains(imageName, "_thumb") || isSidecarFile(imageFile.Name()) {
+						continue
+					}
+
+					imagePath := filepath.Join(subgroupPath, imageFile.Name())
+					format, err := detectFormat(imagePath)
+					if err != nil {
+						c.Unsupported = append(c.Unsupported, FileError{Path: imagePath, Stage: StageFormat, Err: err.Error(), Warning: true})
+						continue
+					}
+
+					var imageMeta *Sidecar
+					if sidecarPath := findSidecar(subgroupPath, imageName); sidecarPath != "" {
+						imageMeta, err = loadSidecar(sidecarPath)
+						if err != nil {
+							c.InvalidSidecars = append(c.InvalidSidecars, err)
+						}
+					}
+
+					img := catalogImage{
+						Family:    familyName,
+						Group:     groupName,
+						Subgroup:  subgroupName,
+						Name:      imageName,
+						FilePath:  filepath.Join("static", "images", familyName, groupName, subgroupName, imageFile.Name()),
+						ThumbPath: filepath.Join("static", "images", familyName, groupName, subgroupName, thumbName(imageFile.Name())),
+						Format:    format,
+						Meta:      mergeSidecars(subgroupMeta, imageMeta),
+					}
+					c.Images[img.key()] = img
+				}
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// loadCatalog читает из базы текущие изображения и таксономию
+func loadCatalog(db *sql.DB) (*catalog, error) {
+	c := newCatalog()
+
+	rows, err := db.Query(`
+		SELECT f.name, COALESCE(g.name, ''), COALESCE(s.name, '')
+		FROM Families f
+		LEFT JOIN Groups g ON g.family_id = f.id
+		LEFT JOIN Subgroups s ON s.group_id = g.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family, group, subgroup string
+		if err := rows.Scan(&family, &group, &subgroup); err != nil {
+			return nil, err
+		}
+		c.Families[family] = true
+		if group != "" {
+			c.Groups[family+"/"+group] = true
+		}
+		if subgroup != "" {
+			c.Subgroups[family+"/"+group+"/"+subgroup] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	imageRows, err := db.Query(`
+		SELECT f.name, g.name, s.name, i.name, COALESCE(i.file_path, ''), COALESCE(i.thumb_path, ''),
+			i.meta_tags, i.title, i.description, i.author, i.license,
+			COALESCE(i.source_hash, ''), COALESCE(i.source_size, 0), i.source_mtime,
+			COALESCE(i.thumb_hash, ''), COALESCE(i.thumb_size, 0), i.thumb_mtime
+		FROM Images i
+		JOIN Subgroups s ON i.subgroup_id = s.id
+		JOIN Groups g ON s.group_id = g.id
+		JOIN Families f ON g.family_id = f.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer imageRows.Close()
+	for imageRows.Next() {
+		var img catalogImage
+		var sourceMtime, thumbMtime sql.NullTime
+		if err := imageRows.Scan(&img.Family, &img.Group, &img.Subgroup, &img.Name, &img.FilePath, &img.ThumbPath,
+			pq.Array(&img.Meta.Tags), &img.Meta.Title, &img.Meta.Description, &img.Meta.Author, &img.Meta.License,
+			&img.Source.Hash, &img.Source.Size, &sourceMtime, &img.Thumb.Hash, &img.Thumb.Size, &thumbMtime); err != nil {
+			return nil, err
+		}
+		img.Source.ModTime = sourceMtime.Time
+		img.Thumb.ModTime = thumbMtime.Time
+		c.Images[img.key()] = img
+	}
+	if err := imageRows.Err(); err != nil {
+		return nil, err
+	}
+
+	renditionRows, err := db.Query(`
+		SELECT f.name || '/' || g.name || '/' || s.name || '/' || i.name,
+			r.name, r.path, r.max_size, r.crop, r.width, r.height, r.hash, r.size, r.mtime
+		FROM image_renditions r
+		JOIN Images i ON r.image_id = i.id
+		JOIN Subgroups s ON i.subgroup_id = s.id
+		JOIN Groups g ON s.group_id = g.id
+		JOIN Families f ON g.family_id = f.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer renditionRows.Close()
+	for renditionRows.Next() {
+		var key string
+		var r storedRendition
+		if err := renditionRows.Scan(&key, &r.Name, &r.Path, &r.Size, &r.Crop, &r.Width, &r.Height,
+			&r.File.Hash, &r.File.Size, &r.File.ModTime); err != nil {
+			return nil, err
+		}
+		img, ok := c.Images[key]
+		if !ok {
+			continue
+		}
+		if img.Renditions == nil {
+			img.Renditions = make(map[string]storedRendition)
+		}
+		img.Renditions[r.Name] = r
+		c.Images[key] = img
+	}
+
+	return c, renditionRows.Err()
+}
+
+// ImageChange — изменение одного изображения; Fields — изменившиеся поля для обновлённых
+type ImageChange struct {
+	Key    string   `json:"key"`
+	Path   string   `json:"path"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// CatalogDiff — изменения, которые загрузка внесёт в базу
+type CatalogDiff struct {
+	AddedFamilies    []string      `json:"added_families"`
+	AddedGroups      []string      `json:"added_groups"`
+	AddedSubgroups   []string      `json:"added_subgroups"`
+	RemovedFamilies  []string      `json:"removed_families"`
+	RemovedGroups    []string      `json:"removed_groups"`
+	RemovedSubgroups []string      `json:"removed_subgroups"`
+	AddedImages      []ImageChange `json:"added_images"`
+	UpdatedImages    []ImageChange `json:"updated_images"`
+	RemovedImages    []ImageChange `json:"removed_images"`
+	// Изображения без изменений
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty сообщает, что загрузка ничего не изменит
+func (d *CatalogDiff) Empty() bool {
+	return len(d.AddedFamilies)+len(d.AddedGroups)+len(d.AddedSubgroups)+
+		len(d.RemovedFamilies)+len(d.RemovedGroups)+len(d.RemovedSubgroups)+
+		len(d.AddedImages)+len(d.UpdatedImages)+len(d.RemovedImages) == 0
+}
+
+// diffCatalog сравнивает состояние на диске с базой. Удаления попадают в diff только при prune.
+func diffCatalog(disk, db *catalog, prune bool) *CatalogDiff {
+	d := &CatalogDiff{
+		AddedFamilies:  missingKeys(disk.Families, db.Families),
+		AddedGroups:    missingKeys(disk.Groups, db.Groups),
+		AddedSubgroups: missingKeys(disk.Subgroups, db.Subgroups),
+	}
+	if prune {
+		d.RemovedFamilies = missingKeys(db.Families, disk.Families)
+		d.RemovedGroups = missingKeys(db.Groups, disk.Groups)
+		d.RemovedSubgroups = missingKeys(db.Subgroups, disk.Subgroups)
+	}
+
+	for key, img := range disk.Images {
+		existing, ok := db.Images[key]
+		if !ok {
+			d.AddedImages = append(d.AddedImages, ImageChange{Key: key, Path: img.FilePath})
+			continue
+		}
+		if fields := changedFields(existing, img); len(fields) > 0 {
+			d.UpdatedImages = append(d.UpdatedImages, ImageChange{Key: key, Path: img.FilePath, Fields: fields})
+		} else {
+			d.Unchanged++
+		}
+	}
+	if prune {
+		for key, img := range db.Images {
+			if _, ok := disk.Images[key]; !ok {
+				d.RemovedImages = append(d.RemovedImages, ImageChange{Key: key, Path: img.FilePath})
+			}
+		}
+	}
+
+	for _, changes := range [][]ImageChange{d.AddedImages, d.UpdatedImages, d.RemovedImages} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	}
+	return d
+}
+
+// missingKeys возвращает отсортированные ключи from, которых нет в other
+func missingKeys(from, other map[string]bool) []string {
+	var keys []string
+	for key := range from {
+		if !other[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// changedFields перечисляет поля, которые загрузка перезапишет у существующего изображения
+func changedFields(old, new catalogImage) []string {
+	var fields []string
+	if old.FilePath != new.FilePath {
+		fields = append(fields, "file_path")
+	}
+	if old.ThumbPath != new.ThumbPath {
+		fields = append(fields, "thumb_path")
+	}
+	if strings.Join(old.Meta.Tags, "\x00") != strings.Join(new.Meta.Tags, "\x00") {
+		fields = append(fields, "tags")
+	}
+	if old.Meta.Title != new.Meta.Title {
+		fields = append(fields, "title")
+	}
+	if old.Meta.Description != new.Meta.Description {
+		fields = append(fields, "description")
+	}
+	if old.Meta.Author != new.Meta.Author {
+		fields = append(fields, "author")
+	}
+	if old.Meta.License != new.Meta.License {
+		fields = append(fields, "license")
+	}
+	if new.SourceChanged {
+		fields = append(fields, "content")
+	}
+	return fields
+}
+
+// Print выводит diff: число изменений каждого вида и их список
+func (d *CatalogDiff) Print(w io.Writer) {
+	printKeys := func(title string, added, removed []string) {
+		fmt.Fprintf(w, "%s: +%d -%d\n", title, len(added), len(removed))
+		for _, key := range added {
+			fmt.Fprintf(w, "  + %s\n", key)
+		}
+		for _, key := range removed {
+			fmt.Fprintf(w, "  - %s\n", key)
+		}
+	}
+	printKeys("Families", d.AddedFamilies, d.RemovedFamilies)
+	printKeys("Groups", d.AddedGroups, d.RemovedGroups)
+	printKeys("Subgroups", d.AddedSubgroups, d.RemovedSubgroups)
+
+	fmt.Fprintf(w, "Images: +%d ~%d -%d (unchanged %d)\n", len(d.AddedImages), len(d.UpdatedImages), len(d.RemovedImages), d.Unchanged)
+	for _, c := range d.AddedImages {
+		fmt.Fprintf(w, "  + %s (%s)\n", c.Key, c.Path)
+	}
+	for _, c := range d.UpdatedImages {
+		fmt.Fprintf(w, "  ~ %s: %s\n", c.Key, strings.Join(c.Fields, ", "))
+	}
+	for _, c := range d.RemovedImages {
+		fmt.Fprintf(w, "  - %s (%s)\n", c.Key, c.Path)
+	}
+}
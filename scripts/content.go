@@ -0,0 +1,83 @@
+package scripts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+)
+
+// fileState — содержимое файла на момент загрузки. Хэш пересчитывается, только если
+// размер или время изменения отличаются от записанных в базе.
+type fileState struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// same сообщает, что файл не менялся с тех пор, как для него посчитан хэш prev
+func (s fileState) same(prev fileState) bool {
+	return prev.Hash != "" && s.Size == prev.Size && s.ModTime.Equal(prev.ModTime)
+}
+
+// statFile возвращает размер и время изменения файла. Время округляется до микросекунд —
+// с такой точностью его хранит Postgres.
+func statFile(path string) (fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{Size: info.Size(), ModTime: info.ModTime().Truncate(time.Microsecond)}, nil
+}
+
+// currentState возвращает состояние файла path, беря хэш из prev, если файл не менялся
+func currentState(path string, prev fileState) (fileState, error) {
+	state, err := statFile(path)
+	if err != nil {
+		return state, err
+	}
+	if state.same(prev) {
+		state.Hash = prev.Hash
+		return state, nil
+	}
+	state.Hash, err = hashFile(path)
+	return state, err
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolveContent считает хэши файлов изображений disk и отмечает файлы, заменённые с прошлой
+// загрузки. Изображения без хэша в базе (загруженные до его появления) заменёнными не считаются.
+// Для миниатюр (в том числе разных размеров) переносит из базы прошлое состояние, чтобы не пересчитывать их хэши без нужды.
+// Возвращает ошибки чтения по ключу изображения.
+func resolveContent(baseFolder string, disk, existing *catalog) map[string]error {
+	errs := make(map[string]error)
+	for key, img := range disk.Images {
+		prev, ok := existing.Images[key]
+
+		source, err := currentState(img.sourcePath(baseFolder), prev.Source)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		img.Source = source
+		img.SourceChanged = ok && prev.Source.Hash != "" && prev.Source.Hash != source.Hash
+		img.Thumb = prev.Thumb
+		img.Renditions = prev.Renditions
+		disk.Images[key] = img
+	}
+	return errs
+}
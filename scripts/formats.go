@@ -0,0 +1,40 @@
+package scripts
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// formatSVG — формат векторных изображений; остальные форматы называются так, как их
+// регистрирует пакет image (jpeg, png, gif, webp, tiff, bmp)
+const formatSVG = "svg"
+
+// detectFormat определяет формат файла по содержимому, а SVG — по расширению.
+// Файлы, которые не удаётся декодировать, загрузка пропускает.
+func detectFormat(path string) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		return formatSVG, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", fmt.Errorf("unsupported image format: %w", err)
+	}
+	return format, nil
+}
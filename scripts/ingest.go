@@ -0,0 +1,174 @@
+package scripts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// IngestOptions управляет загрузкой изображений из папки
+type IngestOptions struct {
+	// Только показать изменения, не меняя базу и не создавая миниатюры
+	DryRun bool
+	// Удалять из базы изображения и таксономию, которых больше нет на диске
+	Prune bool
+	// Выводить каждый обрабатываемый файл
+	Verbose bool
+	// Пропускать файлы с ошибками и загружать остальные; без этого ошибка файла отменяет всю загрузку
+	ContinueOnError bool
+	// Сколько миниатюр создаётся параллельно; 0 — по числу процессоров
+	Workers int
+	// Миниатюры разных размеров; nil — DefaultRenditions
+	Renditions []Rendition
+	// Вызывается после создания миниатюр каждого изображения
+	Progress func(done, total int)
+	// Вызывается с diff до создания миниатюр и записи в базу
+	OnDiff func(*CatalogDiff)
+}
+
+// Этапы обработки файла, на которых может возникнуть ошибка
+const (
+	StageFormat    = "format"
+	StageSidecar   = "sidecar"
+	StageHash      = "hash"
+	StageThumbnail = "thumbnail"
+	StageUpsert    = "upsert"
+	StageAnalyze   = "analyze"
+)
+
+// FileError — ошибка обработки одного файла. Warning — файл загружен, но без части данных
+// (некорректный sidecar, не удалось проанализировать изображение), или пропущен, потому что
+// это не изображение известного формата.
+type FileError struct {
+	Path    string `json:"path"`
+	Stage   string `json:"stage"`
+	Err     string `json:"error"`
+	Warning bool   `json:"warning,omitempty"`
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Stage, e.Path, e.Err)
+}
+
+// IngestReport — результат загрузки
+type IngestReport struct {
+	Diff   *CatalogDiff `json:"diff"`
+	DryRun bool         `json:"dry_run"`
+	// Транзакция загрузки зафиксирована
+	Applied   bool `json:"applied"`
+	Added     int  `json:"added"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Removed   int  `json:"removed"`
+	// Файлы, пропущенные из-за ошибок (только при ContinueOnError)
+	Failed            int           `json:"failed"`
+	ThumbnailsCreated int           `json:"thumbnails_created"`
+	Analyzed          int           `json:"analyzed"`
+	Errors            []FileError   `json:"errors"`
+	Duration          time.Duration `json:"duration"`
+}
+
+// Ingest сравнивает папку baseFolder с базой и, если это не DryRun, создаёт недостающие и устаревшие миниатюры
+// и применяет изменения в одной транзакции. Отмена ctx останавливает загрузку без изменений в базе.
+// Отчёт возвращается и при ошибке: по нему видно, на каком файле загрузка остановилась.
+func Ingest(ctx context.Context, db *sql.DB, baseFolder string, opts IngestOptions) (*IngestReport, error) {
+	started := time.Now()
+	report := &IngestReport{DryRun: opts.DryRun, Errors: []FileError{}}
+	defer func() {
+		report.Duration = time.Since(started)
+	}()
+
+	disk, err := scanCatalog(baseFolder)
+	if err != nil {
+		return report, fmt.Errorf("scan %s: %w", baseFolder, err)
+	}
+	existing, err := loadCatalog(db)
+	if err != nil {
+		return report, fmt.Errorf("load catalog: %w", err)
+	}
+	// Ошибки файлов, найденные до записи в базу, по ключу изображения
+	fileErrors := make(map[string]*FileError)
+	for key, err := range resolveContent(baseFolder, disk, existing) {
+		fileErrors[key] = &FileError{Path: disk.Images[key].sourcePath(baseFolder), Stage: StageHash, Err: err.Error()}
+	}
+	report.Diff = diffCatalog(disk, existing, opts.Prune)
+	if opts.OnDiff != nil {
+		opts.OnDiff(report.Diff)
+	}
+
+	report.Errors = append(report.Errors, disk.Unsupported...)
+	for _, err := range disk.InvalidSidecars {
+		fileErr := FileError{Stage: StageSidecar, Err: err.Error(), Warning: true}
+		var sidecarErr *SidecarError
+		if errors.As(err, &sidecarErr) {
+			fileErr.Path = sidecarErr.Path
+			fileErr.Err = sidecarErr.Err.Error()
+		}
+		report.Errors = append(report.Errors, fileErr)
+	}
+
+	if opts.DryRun {
+		for _, key := range sortedKeys(fileErrors) {
+			report.Errors = append(report.Errors, *fileErrors[key])
+		}
+		return report, nil
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if opts.Renditions == nil {
+		opts.Renditions = DefaultRenditions
+	}
+	created, thumbErrors, err := generateThumbnails(ctx, staleThumbnails(baseFolder, disk, opts.Renditions, fileErrors), workers, opts.Progress)
+	report.ThumbnailsCreated = created
+	if err != nil {
+		return report, err
+	}
+	for key, err := range thumbErrors {
+		fileErrors[key] = &FileError{Path: disk.Images[key].sourcePath(baseFolder), Stage: StageThumbnail, Err: err.Error()}
+	}
+
+	if err := applyCatalog(ctx, db, baseFolder, disk, report.Diff, fileErrors, opts, report); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// Print выводит diff, итоги загрузки и ошибки по файлам
+func (r *IngestReport) Print(w io.Writer) {
+	if r.Diff != nil {
+		r.Diff.Print(w)
+	}
+	r.PrintSummary(w)
+}
+
+// PrintSummary выводит итоги загрузки и ошибки по файлам без diff
+func (r *IngestReport) PrintSummary(w io.Writer) {
+	switch {
+	case r.DryRun:
+		fmt.Fprintln(w, "Dry run: no changes applied.")
+	case !r.Applied:
+		fmt.Fprintln(w, "Ingest stopped, no changes applied.")
+	default:
+		fmt.Fprintf(w, "Applied: %d added, %d updated, %d unchanged, %d removed, %d failed; %d thumbnails created, %d images analyzed in %v\n",
+			r.Added, r.Updated, r.Unchanged, r.Removed, r.Failed, r.ThumbnailsCreated, r.Analyzed, r.Duration.Round(time.Millisecond))
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(w, "Errors (%d):\n", len(r.Errors))
+		for _, e := range r.Errors {
+			level := "error"
+			if e.Warning {
+				level = "warning"
+			}
+			fmt.Fprintf(w, "  %s [%s] %s: %s\n", level, e.Stage, e.Path, e.Err)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package scripts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Правила проверки имён файлов
+const (
+	// Имя не соответствует Family_Group_Subgroup_NN для своей папки
+	LintName = "name"
+	// Несколько файлов с одним номером или одним именем без расширения
+	LintDuplicate = "duplicate"
+	// Пропущенные номера в подгруппе
+	LintGap = "gap"
+	// Миниатюра без исходного изображения
+	LintOrphanThumbnail = "orphan_thumbnail"
+	// Расширение не соответствует формату файла
+	LintExtension = "extension"
+	// Файл не распознаётся как изображение
+	LintUnsupported = "unsupported"
+)
+
+// LintFinding — найденное нарушение. FixPath — куда файл будет переименован при исправлении;
+// пустой FixPath у исправимого нарушения означает, что файл будет удалён.
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	Fixable bool   `json:"fixable"`
+	FixPath string `json:"fix_path,omitempty"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// LintReport — результат проверки папки с изображениями
+type LintReport struct {
+	Files    int           `json:"files"`
+	Findings []LintFinding `json:"findings"`
+	Fixed    int           `json:"fixed"`
+}
+
+// Unfixed возвращает число нарушений, которые остались после проверки
+func (r *LintReport) Unfixed() int {
+	return len(r.Findings) - r.Fixed
+}
+
+// Print выводит нарушения по одному в строке: правило, путь, описание и исправление
+func (r *LintReport) Print(w io.Writer) {
+	for _, f := range r.Findings {
+		line := fmt.Sprintf("[%s] %s: %s", f.Rule, f.Path, f.Message)
+		switch {
+		case f.Fixed && f.FixPath != "":
+			line += " (renamed to " + f.FixPath + ")"
+		case f.Fixed:
+			line += " (removed)"
+		case f.Fixable && f.FixPath != "":
+			line += " (fix: rename to " + f.FixPath + ")"
+		case f.Fixable:
+			line += " (fix: remove)"
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "Checked %d files: %d findings, %d fixed\n", r.Files, len(r.Findings), r.Fixed)
+}
+
+// lintFile — файл изображения в подгруппе
+type lintFile struct {
+	name   string
+	base   string
+	ext    string
+	format string
+	// Номер и его цифры, если имя соответствует соглашению
+	number int
+	digits string
+	// Имя и расширение после исправления
+	targetBase string
+	targetExt  string
+	findings   []int
+}
+
+// lintRename — переименование файла изображения при исправлении
+type lintRename struct {
+	family, group, subgroup string
+	dir                     string
+	from, to                *lintFile
+	// Имя без расширения остаётся у другого файла вместе с миниатюрами и sidecar
+	shared bool
+}
+
+var trailingNumber = regexp.MustCompile(`_(\d+)$`)
+
+// Lint проверяет имена файлов в baseFolder/{family}/{group}/{subgroup}: соответствие соглашению
+// Family_Group_Subgroup_NN, пропуски и повторы номеров, миниатюры без исходников и расширения,
+// не совпадающие с форматом. С fix переименовывает файлы (вместе с миниатюрами и sidecar) и
+// удаляет лишние миниатюры; записи изображений в db переименовываются в той же транзакции,
+// поэтому ID и история использования сохраняются.
+func Lint(ctx context.Context, db *sql.DB, baseFolder string, fix bool) (*LintReport, error) {
+	report := &LintReport{Findings: []LintFinding{}}
+	var renames []lintRename
+	var orphans []int
+
+	err := walkSubgroups(baseFolder, func(family, group, subgroup, dir string) error {
+		subgroupRenames, subgroupOrphans, err := lintSubgroup(report, family, group, subgroup, dir)
+		renames = append(renames, subgroupRenames...)
+		orphans = append(orphans, subgroupOrphans...)
+		return err
+	})
+	if err != nil || !fix || len(renames)+len(orphans) == 0 {
+		return report, err
+	}
+	if db == nil {
+		return report, fmt.Errorf("fix requires a database connection")
+	}
+
+	orphanPaths := make([]string, len(orphans))
+	for i, finding := range orphans {
+		orphanPaths[i] = report.Findings[finding].Path
+	}
+	if err := applyLintFixes(ctx, db, baseFolder, renames, orphanPaths); err != nil {
+		return report, err
+	}
+	fixed := orphans
+	for _, rename := range renames {
+		fixed = append(fixed, rename.from.findings...)
+	}
+	for _, i := range fixed {
+		report.Findings[i].Fixed = true
+		report.Fixed++
+	}
+	return report, nil
+}
+
+// walkSubgroups вызывает fn для каждой папки подгруппы baseFolder/{family}/{group}/{subgroup}
+func walkSubgroups(baseFolder string, fn func(family, group, subgroup, dir string) error) error {
+	families, err := readDirs(baseFolder)
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		groups, err := readDirs(filepath.Join(baseFolder, family))
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			subgroups, err := readDirs(filepath.Join(baseFolder, family, group))
+			if err != nil {
+				return err
+			}
+			for _, subgroup := range subgroups {
+				if err := fn(family, group, subgroup, filepath.Join(baseFolder, family, group, subgroup)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readDirs возвращает имена вложенных папок dir
+func readDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// lintSubgroup проверяет файлы одной подгруппы, добавляет нарушения в report и возвращает
+// нужные переименования и индексы нарушений для миниатюр-сирот
+func lintSubgroup(report *LintReport, family, group, subgroup, dir string) ([]lintRename, []int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	add := func(f LintFinding) int {
+		report.Findings = append(report.Findings, f)
+		return len(report.Findings) - 1
+	}
+
+	prefix := family + "_" + group + "_" + subgroup + "_"
+	var files []*lintFile
+	var thumbs []string
+	bases := make(map[string][]*lintFile)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || isSidecarFile(name) {
+			continue
+		}
+		report.Files++
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		if strings.Contains(base, "_thumb") {
+			thumbs = append(thumbs, name)
+			continue
+		}
+
+		format, err := detectFormat(filepath.Join(dir, name))
+		if err != nil {
+			add(LintFinding{Rule: LintUnsupported, Path: filepath.Join(dir, name), Message: err.Error()})
+			continue
+		}
+		f := &lintFile{name: name, base: base, ext: filepath.Ext(name), format: format, number: -1}
+		if digits := strings.TrimPrefix(base, prefix); digits != base && len(digits) >= 2 && isDigits(digits) {
+			f.number, _ = strconv.Atoi(digits)
+			f.digits = digits
+		}
+		files = append(files, f)
+		bases[base] = append(bases[base], f)
+	}
+
+	var orphans []int
+	for _, thumb := range thumbs {
+		base := strings.TrimSuffix(thumb, filepath.Ext(thumb))
+		if original := base[:strings.Index(base, "_thumb")]; len(bases[original]) == 0 {
+			orphans = append(orphans, add(LintFinding{Rule: LintOrphanThumbnail, Path: filepath.Join(dir, thumb),
+				Message: fmt.Sprintf("no original image %s.*", original), Fixable: true}))
+		}
+	}
+
+	// Номера: сначала файлы по соглашению (первый из повторов сохраняет номер), затем остальные
+	// (номер из конца имени, если свободен), затем все, кому номер не достался, — по порядку после последнего
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	taken := make(map[int]bool)
+	width, last := 2, 0
+	for _, f := range files {
+		if f.number > last {
+			last = f.number
+		}
+		if len(f.digits) > width {
+			width = len(f.digits)
+		}
+	}
+	var queue []*lintFile
+	for _, f := range files {
+		if f.number < 0 {
+			continue
+		}
+		if taken[f.number] {
+			f.findings = append(f.findings, add(LintFinding{Rule: LintDuplicate, Path: filepath.Join(dir, f.name),
+				Message: fmt.Sprintf("number %d is used by another file", f.number), Fixable: true}))
+			queue = append(queue, f)
+			continue
+		}
+		taken[f.number] = true
+		f.targetBase = f.base
+	}
+	for _, f := range files {
+		if f.number >= 0 {
+			continue
+		}
+		f.findings = append(f.findings, add(LintFinding{Rule: LintName, Path: filepath.Join(dir, f.name),
+			Message: fmt.Sprintf("name does not match %sNN", prefix), Fixable: true}))
+		if m := trailingNumber.FindStringSubmatch(f.base); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > 0 && !taken[n] {
+				taken[n] = true
+				f.targetBase = fmt.Sprintf("%s%0*d", prefix, width, n)
+				if n > last {
+					last = n
+				}
+				continue
+			}
+		}
+		queue = append(queue, f)
+	}
+	for _, f := range queue {
+		last++
+		taken[last] = true
+		f.targetBase = fmt.Sprintf("%s%0*d", prefix, width, last)
+	}
+
+	// Несколько файлов с одним именем без расширения загрузка считает одним изображением
+	for _, same := range bases {
+		for _, f := range same[1:] {
+			if f.targetBase == f.base {
+				f.findings = append(f.findings, add(LintFinding{Rule: LintDuplicate, Path: filepath.Join(dir, f.name),
+					Message: fmt.Sprintf("another file is named %s", f.base), Fixable: true}))
+				last++
+				f.targetBase = fmt.Sprintf("%s%0*d", prefix, width, last)
+			}
+		}
+	}
+
+	for _, f := range files {
+		f.targetExt = f.ext
+		if !extensionMatches(f.ext, f.format) {
+			f.targetExt = formatExt(f.format)
+			f.findings = append(f.findings, add(LintFinding{Rule: LintExtension, Path: filepath.Join(dir, f.name),
+				Message: fmt.Sprintf("file is %s, extension is %s", f.format, f.ext), Fixable: true}))
+		}
+	}
+
+	if missing := numberGaps(files); len(missing) > 0 {
+		add(LintFinding{Rule: LintGap, Path: dir, Message: "missing numbers " + strings.Join(missing, ", ")})
+	}
+
+	var renames []lintRename
+	for _, f := range files {
+		if len(f.findings) == 0 {
+			continue
+		}
+		to := &lintFile{name: f.targetBase + f.targetExt, base: f.targetBase, ext: f.targetExt}
+		for _, i := range f.findings {
+			report.Findings[i].FixPath = filepath.Join(dir, to.name)
+		}
+		shared := false
+		for _, other := range bases[f.base] {
+			shared = shared || (other != f && other.targetBase == f.base)
+		}
+		renames = append(renames, lintRename{family: family, group: group, subgroup: subgroup, dir: dir, from: f, to: to, shared: shared})
+	}
+	return renames, orphans, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// extensionMatches сообщает, подходит ли расширение ext к формату, который вернул detectFormat
+func extensionMatches(ext, format string) bool {
+	ext = strings.ToLower(ext)
+	switch format {
+	case "jpeg":
+		return ext == ".jpg" || ext == ".jpeg"
+	case "tiff":
+		return ext == ".tif" || ext == ".tiff"
+	default:
+		return ext == "."+format
+	}
+}
+
+// numberGaps возвращает пропущенные номера от 1 до наибольшего среди файлов, которые уже названы
+// по соглашению. Номера, которые файлы получат только после исправления, не учитываются.
+func numberGaps(files []*lintFile) []string {
+	present := make(map[int]bool)
+	maxNumber := 0
+	for _, f := range files {
+		if f.number < 0 {
+			continue
+		}
+		present[f.number] = true
+		if f.number > maxNumber {
+			maxNumber = f.number
+		}
+	}
+	var missing []string
+	for n := 1; n < maxNumber; n++ {
+		if !present[n] {
+			missing = append(missing, strconv.Itoa(n))
+		}
+	}
+	return missing
+}
+
+// applyLintFixes переименовывает файлы изображений с их миниатюрами и sidecar и обновляет записи
+// в базе в одной транзакции. Миниатюры-сироты сначала убираются в скрытые файлы, чтобы освободить
+// имена для миниатюр переименованных изображений. При ошибке файлы возвращаются на место. Сироты и
+// миниатюры, у которых меняется формат, удаляются после фиксации: следующая загрузка создаст их заново.
+func applyLintFixes(ctx context.Context, db *sql.DB, baseFolder string, renames []lintRename, orphans []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var moves fileMoves
+	var stale []string
+	for _, path := range orphans {
+		hidden := filepath.Join(filepath.Dir(path), ".deleted-"+filepath.Base(path))
+		if err := moves.move(path, hidden); err != nil {
+			moves.undo()
+			return err
+		}
+		stale = append(stale, hidden)
+	}
+	for _, r := range renames {
+		removed, err := renameLintFiles(tx, baseFolder, r, &moves)
+		if err != nil {
+			moves.undo()
+			return err
+		}
+		stale = append(stale, removed...)
+	}
+	if err := tx.Commit(); err != nil {
+		moves.undo()
+		return err
+	}
+	for _, path := range stale {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// renameLintFiles переименовывает файлы одного изображения и его запись. Возвращает миниатюры,
+// которые нужно удалить после фиксации.
+func renameLintFiles(tx *sql.Tx, baseFolder string, r lintRename, moves *fileMoves) ([]string, error) {
+	if err := moves.move(filepath.Join(r.dir, r.from.name), filepath.Join(r.dir, r.to.name)); err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	sameBase := r.from.base == r.to.base
+	sameFormat := thumbExt(r.from.name) == thumbExt(r.to.name)
+	if !r.shared && !(sameBase && sameFormat) {
+		entries, err := os.ReadDir(r.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			switch {
+			case isSidecarFile(name) && strings.TrimSuffix(name, filepath.Ext(name)) == r.from.base:
+				if sameBase {
+					continue
+				}
+				if err := moves.move(filepath.Join(r.dir, name), filepath.Join(r.dir, r.to.base+filepath.Ext(name))); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(name, r.from.base+"_thumb"):
+				if !sameFormat {
+					stale = append(stale, filepath.Join(r.dir, name))
+					continue
+				}
+				renamed := r.to.base + strings.TrimPrefix(name, r.from.base)
+				if err := moves.move(filepath.Join(r.dir, name), filepath.Join(r.dir, renamed)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	staticDir := filepath.Join("static", "images", r.family, r.group, r.subgroup)
+	var imageID int
+	err := tx.QueryRow(`
+		UPDATE Images SET name = $2, file_path = $3, thumb_path = $4, updated_at = now()
+		WHERE file_path = $1
+		RETURNING id`,
+		filepath.Join(staticDir, r.from.name), r.to.base, filepath.Join(staticDir, r.to.name),
+		filepath.Join(staticDir, thumbName(r.to.name))).Scan(&imageID)
+	if err == sql.ErrNoRows {
+		// Файл ещё не загружен в базу
+		return stale, nil
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	_, err = tx.Exec(`
+		UPDATE image_renditions SET path = $2 || '/' || $3 || '_thumb_' || name || $4
+		WHERE image_id = $1`, imageID, staticDir, r.to.base, thumbExt(r.to.name))
+	return stale, err
+}
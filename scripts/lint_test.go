@@ -0,0 +1,182 @@
+package scripts
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeLintImage создаёт в dir изображение 4x4 в формате format (jpeg или png) независимо от расширения name
+func writeLintImage(t *testing.T, dir, name, format string) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	if format == "jpeg" {
+		err = jpeg.Encode(f, img, nil)
+	} else {
+		err = png.Encode(f, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLintSubgroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// Переименования: исходное имя → новое
+		renames map[string]string
+		// Нарушения в виде "rule name" (для gap — "gap" и список номеров)
+		findings []string
+		// Переименования, у которых имя без расширения остаётся у другого файла
+		shared []string
+	}{
+		{
+			name:     "conforming",
+			files:    map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_02.png": "png"},
+			renames:  map[string]string{},
+			findings: []string{},
+		},
+		{
+			name:    "duplicate number keeps first name",
+			files:   map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_01.png": "png", "F_G_S_02.jpg": "jpeg"},
+			renames: map[string]string{"F_G_S_01.png": "F_G_S_03.png"},
+			findings: []string{
+				"duplicate F_G_S_01.png",
+			},
+			shared: []string{"F_G_S_01.png"},
+		},
+		{
+			name:    "trailing number fills gap",
+			files:   map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_03.jpg": "jpeg", "Foo_2.jpg": "jpeg"},
+			renames: map[string]string{"Foo_2.jpg": "F_G_S_02.jpg"},
+			findings: []string{
+				"gap missing numbers 2",
+				"name Foo_2.jpg",
+			},
+		},
+		{
+			name:     "taken trailing number goes after last",
+			files:    map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_02.jpg": "jpeg", "photo_2.jpg": "jpeg"},
+			renames:  map[string]string{"photo_2.jpg": "F_G_S_03.jpg"},
+			findings: []string{"name photo_2.jpg"},
+		},
+		{
+			name:    "renumbered files follow duplicates",
+			files:   map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_01.png": "png", "a.jpg": "jpeg", "b.jpg": "jpeg"},
+			renames: map[string]string{"F_G_S_01.png": "F_G_S_02.png", "a.jpg": "F_G_S_03.jpg", "b.jpg": "F_G_S_04.jpg"},
+			findings: []string{
+				"duplicate F_G_S_01.png",
+				"name a.jpg",
+				"name b.jpg",
+			},
+			shared: []string{"F_G_S_01.png"},
+		},
+		{
+			name:     "keeps number width",
+			files:    map[string]string{"F_G_S_001.jpg": "jpeg", "x.jpg": "jpeg"},
+			renames:  map[string]string{"x.jpg": "F_G_S_002.jpg"},
+			findings: []string{"name x.jpg"},
+		},
+		{
+			name:     "extension follows format",
+			files:    map[string]string{"F_G_S_01.png": "jpeg", "F_G_S_02.JPG": "jpeg"},
+			renames:  map[string]string{"F_G_S_01.png": "F_G_S_01.jpg"},
+			findings: []string{"extension F_G_S_01.png"},
+		},
+		{
+			name:    "duplicate with wrong extension",
+			files:   map[string]string{"F_G_S_01.jpg": "jpeg", "F_G_S_01.png": "jpeg"},
+			renames: map[string]string{"F_G_S_01.png": "F_G_S_02.jpg"},
+			findings: []string{
+				"duplicate F_G_S_01.png",
+				"extension F_G_S_01.png",
+			},
+			shared: []string{"F_G_S_01.png"},
+		},
+		{
+			name: "orphan thumbnails",
+			files: map[string]string{
+				"F_G_S_01.jpg": "jpeg", "F_G_S_01_thumb.jpg": "jpeg", "F_G_S_01_thumb_small.jpg": "jpeg",
+				"F_G_S_02_thumb.png": "png",
+			},
+			renames:  map[string]string{},
+			findings: []string{"orphan_thumbnail F_G_S_02_thumb.png"},
+		},
+		{
+			name:     "gaps only from conforming names",
+			files:    map[string]string{"F_G_S_02.jpg": "jpeg", "F_G_S_05.jpg": "jpeg"},
+			renames:  map[string]string{},
+			findings: []string{"gap missing numbers 1, 3, 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, format := range tt.files {
+				writeLintImage(t, dir, name, format)
+			}
+
+			report := &LintReport{Findings: []LintFinding{}}
+			renames, orphans, err := lintSubgroup(report, "F", "G", "S", dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotRenames := make(map[string]string)
+			var gotShared []string
+			for _, r := range renames {
+				gotRenames[r.from.name] = r.to.name
+				if r.shared {
+					gotShared = append(gotShared, r.from.name)
+				}
+			}
+			if !reflect.DeepEqual(gotRenames, tt.renames) {
+				t.Errorf("renames = %v, want %v", gotRenames, tt.renames)
+			}
+			sort.Strings(gotShared)
+			if strings.Join(gotShared, ",") != strings.Join(tt.shared, ",") {
+				t.Errorf("shared = %v, want %v", gotShared, tt.shared)
+			}
+
+			gotFindings := []string{}
+			for _, f := range report.Findings {
+				if f.Rule == LintGap {
+					gotFindings = append(gotFindings, f.Rule+" "+f.Message)
+				} else {
+					gotFindings = append(gotFindings, f.Rule+" "+filepath.Base(f.Path))
+				}
+			}
+			sort.Strings(gotFindings)
+			if !reflect.DeepEqual(gotFindings, tt.findings) {
+				t.Errorf("findings = %v, want %v", gotFindings, tt.findings)
+			}
+
+			for _, i := range orphans {
+				if report.Findings[i].Rule != LintOrphanThumbnail {
+					t.Errorf("orphan %d is %s finding", i, report.Findings[i].Rule)
+				}
+			}
+			for _, r := range renames {
+				for _, i := range r.from.findings {
+					if want := filepath.Join(dir, r.to.name); report.Findings[i].FixPath != want {
+						t.Errorf("%s fix path = %s, want %s", r.from.name, report.Findings[i].FixPath, want)
+					}
+				}
+			}
+		})
+	}
+}
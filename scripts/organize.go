@@ -0,0 +1,406 @@
+package scripts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrNotFound — изображение, семейство, группа или подгруппа не найдены
+	ErrNotFound = errors.New("not found")
+	// ErrConflict — изображение, узел таксономии или файл с таким именем уже есть
+	ErrConflict = errors.New("already exists")
+	// ErrInvalidName — имя семейства, группы или подгруппы содержит не только латинские буквы и цифры
+	ErrInvalidName = errors.New("invalid name")
+)
+
+// validateTaxonomyName проверяет имя семейства, группы или подгруппы (kind — что именно проверяется)
+func validateTaxonomyName(kind, name string) error {
+	if !taxonomyNamePattern.MatchString(name) {
+		return fmt.Errorf("%s name must contain only letters and digits, got %q", kind, name)
+	}
+	return nil
+}
+
+// fileMoves — выполненные переименования файлов; undo возвращает их назад, если транзакция не удалась
+type fileMoves [][2]string
+
+// move переименовывает from в to, не перезаписывая существующий to
+func (m *fileMoves) move(from, to string) error {
+	if from == to {
+		return nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%w: %s", ErrConflict, to)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	*m = append(*m, [2]string{from, to})
+	return nil
+}
+
+func (m fileMoves) undo() {
+	for i := len(m) - 1; i >= 0; i-- {
+		os.Rename(m[i][1], m[i][0])
+	}
+}
+
+// storedImage — изображение в базе с путями всех его файлов
+type storedImage struct {
+	ID        int
+	Family    string
+	Group     string
+	Subgroup  string
+	Name      string
+	FilePath  string
+	ThumbPath string
+	// Пути миниатюр разных размеров по имени
+	Renditions map[string]string
+}
+
+// imageLocation — семейство, группа, подгруппа и имя изображения
+type imageLocation struct {
+	Family, Group, Subgroup, Name string
+}
+
+func (l imageLocation) dir(baseFolder string) string {
+	return filepath.Join(baseFolder, l.Family, l.Group, l.Subgroup)
+}
+
+// loadStoredImages читает изображения, подходящие под condition (алиасы i, s, g, f), и блокирует их строки
+func loadStoredImages(tx *sql.Tx, condition string, args ...interface{}) ([]storedImage, error) {
+	rows, err := tx.Query(`
+		SELECT i.id, f.name, g.name, s.name, i.name, COALESCE(i.file_path, ''), COALESCE(i.thumb_path, '')
+		FROM Images i
+		JOIN Subgroups s ON i.subgroup_id = s.id
+		JOIN Groups g ON s.group_id = g.id
+		JOIN Families f ON g.family_id = f.id
+		WHERE `+condition+`
+		ORDER BY i.id
+		FOR UPDATE OF i`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []storedImage
+	ids := make([]int64, 0)
+	for rows.Next() {
+		img := storedImage{Renditions: make(map[string]string)}
+		if err := rows.Scan(&img.ID, &img.Family, &img.Group, &img.Subgroup, &img.Name, &img.FilePath, &img.ThumbPath); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+		ids = append(ids, int64(img.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return images, nil
+	}
+
+	byID := make(map[int]*storedImage, len(images))
+	for i := range images {
+		byID[images[i].ID] = &images[i]
+	}
+	renditionRows, err := tx.Query(`SELECT image_id, name, path FROM image_renditions WHERE image_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer renditionRows.Close()
+	for renditionRows.Next() {
+		var imageID int
+		var name, path string
+		if err := renditionRows.Scan(&imageID, &name, &path); err != nil {
+			return nil, err
+		}
+		byID[imageID].Renditions[name] = path
+	}
+	return images, renditionRows.Err()
+}
+
+// relocateImage переносит файлы изображения (сам файл, миниатюры и sidecar) из fromDir в папку to
+// под именем to.Name и обновляет его запись. ID, а с ним и история использования, не меняются.
+// Подгруппа to должна существовать в базе.
+func relocateImage(tx *sql.Tx, baseFolder, fromDir string, img storedImage, to imageLocation, moves *fileMoves) error {
+	toDir := to.dir(baseFolder)
+	fileName := to.Name + filepath.Ext(img.FilePath)
+	staticDir := filepath.Join("static", "images", to.Family, to.Group, to.Subgroup)
+
+	renames := map[string]string{
+		filepath.Base(img.FilePath): fileName,
+	}
+	thumbPath := filepath.Join(staticDir, fileName)
+	if img.ThumbPath != img.FilePath {
+		renames[filepath.Base(img.ThumbPath)] = thumbName(fileName)
+		thumbPath = filepath.Join(staticDir, thumbName(fileName))
+	}
+	renditionPaths := make(map[string]string, len(img.Renditions))
+	for name, path := range img.Renditions {
+		renames[filepath.Base(path)] = renditionName(fileName, name)
+		renditionPaths[name] = filepath.Join(staticDir, renditionName(fileName, name))
+	}
+	if sidecar := findSidecar(fromDir, img.Name); sidecar != "" {
+		renames[filepath.Base(sidecar)] = to.Name + filepath.Ext(sidecar)
+	}
+
+	for oldName, newName := range renames {
+		src := filepath.Join(fromDir, oldName)
+		// Файла может не быть, если папку меняли вручную; запись всё равно обновляется
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := moves.move(src, filepath.Join(toDir, newName)); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`
+		UPDATE Images SET name = $2, file_path = $3, thumb_path = $4, updated_at = now(),
+			subgroup_id = (SELECT s.id FROM Subgroups s
+						   JOIN Groups g ON s.group_id = g.id
+						   JOIN Families f ON g.family_id = f.id
+						   WHERE f.name = $5 AND g.name = $6 AND s.name = $7)
+		WHERE id = $1`,
+		img.ID, to.Name, filepath.Join(staticDir, fileName), thumbPath, to.Family, to.Group, to.Subgroup)
+	if err != nil {
+		return dbError(err)
+	}
+	for name, path := range renditionPaths {
+		if _, err := tx.Exec(`UPDATE image_renditions SET path = $3 WHERE image_id = $1 AND name = $2`, img.ID, name, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbError превращает нарушение уникальности в ErrConflict
+func dbError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrConflict, pqErr.Detail)
+	}
+	return err
+}
+
+// RenameTaxonomy переименовывает семейство (path — [family]), группу ([family, group]) или подгруппу
+// ([family, group, subgroup]) в newName: папку на диске, запись в базе и изображения внутри.
+// Имена изображений по соглашению Family_Group_Subgroup_NN получают новый префикс, остальные
+// сохраняются. Возвращает число перенесённых изображений.
+func RenameTaxonomy(ctx context.Context, db *sql.DB, baseFolder string, path []string, newName string) (int, error) {
+	if len(path) < 1 || len(path) > 3 {
+		return 0, fmt.Errorf("invalid taxonomy path %v", path)
+	}
+	if err := validateTaxonomyName("new", newName); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidName, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Изображения узла читаем до переименования, пока условие совпадает со старыми именами
+	conditions := []string{"f.name = $1", "g.name = $2", "s.name = $3"}
+	args := make([]interface{}, len(path))
+	for i, name := range path {
+		args[i] = name
+	}
+	images, err := loadStoredImages(tx, strings.Join(conditions[:len(path)], " AND "), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var res sql.Result
+	switch len(path) {
+	case 1:
+		res, err = tx.Exec(`UPDATE Families SET name = $2 WHERE name = $1`, path[0], newName)
+	case 2:
+		res, err = tx.Exec(`
+			UPDATE Groups g SET name = $3 FROM Families f
+			WHERE g.family_id = f.id AND f.name = $1 AND g.name = $2`, path[0], path[1], newName)
+	case 3:
+		res, err = tx.Exec(`
+			UPDATE Subgroups s SET name = $4 FROM Groups g, Families f
+			WHERE s.group_id = g.id AND g.family_id = f.id AND f.name = $1 AND g.name = $2 AND s.name = $3`,
+			path[0], path[1], path[2], newName)
+	}
+	if err != nil {
+		return 0, dbError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, strings.Join(path, "/"))
+	}
+
+	var moves fileMoves
+	if err := renameTaxonomyFiles(tx, baseFolder, path, newName, images, &moves); err != nil {
+		moves.undo()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		moves.undo()
+		return 0, err
+	}
+	return len(images), nil
+}
+
+func renameTaxonomyFiles(tx *sql.Tx, baseFolder string, path []string, newName string, images []storedImage, moves *fileMoves) error {
+	oldDir := filepath.Join(append([]string{baseFolder}, path...)...)
+	newDir := filepath.Join(filepath.Dir(oldDir), newName)
+	if _, err := os.Stat(oldDir); err == nil {
+		if err := moves.move(oldDir, newDir); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range images {
+		to := imageLocation{Family: img.Family, Group: img.Group, Subgroup: img.Subgroup}
+		switch len(path) {
+		case 1:
+			to.Family = newName
+		case 2:
+			to.Group = newName
+		case 3:
+			to.Subgroup = newName
+		}
+		to.Name = img.Name
+		if oldPrefix := img.Family + "_" + img.Group + "_" + img.Subgroup + "_"; strings.HasPrefix(img.Name, oldPrefix) {
+			to.Name = to.Family + "_" + to.Group + "_" + to.Subgroup + "_" + strings.TrimPrefix(img.Name, oldPrefix)
+		}
+		// Папка уже переименована: файлы лежат в новой папке под старыми именами
+		if err := relocateImage(tx, baseFolder, to.dir(baseFolder), img, to, moves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveImage переносит изображение в подгруппу family/group/subgroup (недостающая таксономия создаётся)
+// под следующим номером Family_Group_Subgroup_NN. Возвращает новое имя изображения.
+func MoveImage(ctx context.Context, db *sql.DB, baseFolder string, imageID int, family, group, subgroup string) (string, error) {
+	for _, name := range [][2]string{{"family", family}, {"group", group}, {"subgroup", subgroup}} {
+		if err := validateTaxonomyName(name[0], name[1]); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidName, err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	images, err := loadStoredImages(tx, "i.id = $1", imageID)
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("%w: image %d", ErrNotFound, imageID)
+	}
+	img := images[0]
+	if img.Family == family && img.Group == group && img.Subgroup == subgroup {
+		return img.Name, nil
+	}
+
+	// Та же блокировка, что и при загрузке: номер в подгруппе выбирается под ней
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "upload:"+family+"/"+group+"/"+subgroup); err != nil {
+		return "", err
+	}
+	err = addTaxonomy(tx, &CatalogDiff{
+		AddedFamilies:  []string{family},
+		AddedGroups:    []string{family + "/" + group},
+		AddedSubgroups: []string{family + "/" + group + "/" + subgroup},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	to := imageLocation{Family: family, Group: group, Subgroup: subgroup}
+	createdDirs, err := mkdirAll(to.dir(baseFolder))
+	if err != nil {
+		return "", err
+	}
+	if to.Name, err = nextImageName(tx, to.dir(baseFolder), family, group, subgroup); err != nil {
+		removeDirs(createdDirs)
+		return "", err
+	}
+
+	var moves fileMoves
+	from := imageLocation{Family: img.Family, Group: img.Group, Subgroup: img.Subgroup}
+	if err := relocateImage(tx, baseFolder, from.dir(baseFolder), img, to, &moves); err != nil {
+		moves.undo()
+		removeDirs(createdDirs)
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		moves.undo()
+		removeDirs(createdDirs)
+		return "", err
+	}
+	return to.Name, nil
+}
+
+// DeleteImage удаляет изображение из базы и его файлы с диска. События usage_events удаляются каскадно,
+// поэтому использования изображения пропадают из отчётов за прошлые периоды, рекомендаций и истории
+// пользователей. Файлы сначала переименовываются в скрытые и удаляются только после фиксации транзакции.
+func DeleteImage(ctx context.Context, db *sql.DB, baseFolder string, imageID int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	images, err := loadStoredImages(tx, "i.id = $1", imageID)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("%w: image %d", ErrNotFound, imageID)
+	}
+	img := images[0]
+	dir := imageLocation{Family: img.Family, Group: img.Group, Subgroup: img.Subgroup}.dir(baseFolder)
+
+	files := []string{filepath.Base(img.FilePath), filepath.Base(img.ThumbPath)}
+	for _, path := range img.Renditions {
+		files = append(files, filepath.Base(path))
+	}
+	if sidecar := findSidecar(dir, img.Name); sidecar != "" {
+		files = append(files, filepath.Base(sidecar))
+	}
+
+	var moves fileMoves
+	for _, file := range files {
+		src := filepath.Join(dir, file)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		// Скрытые файлы сканирование пропускает, поэтому загрузка не вернёт изображение
+		if err := moves.move(src, filepath.Join(dir, ".deleted-"+file)); err != nil {
+			moves.undo()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM Images WHERE id = $1`, imageID); err != nil {
+		moves.undo()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		moves.undo()
+		return err
+	}
+	for _, m := range moves {
+		os.Remove(m[1])
+	}
+	return nil
+}
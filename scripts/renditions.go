@@ -0,0 +1,135 @@
+package scripts
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// Rendition — миниатюра, которая создаётся для каждого изображения при загрузке
+type Rendition struct {
+	Name string
+	// Длинная сторона в пикселях, а при Crop — сторона квадрата. Изображения меньше не увеличиваются.
+	Size int
+	// Обрезать по центру до квадрата вместо вписывания с сохранением пропорций
+	Crop bool
+}
+
+// DefaultRenditions — миниатюры по умолчанию: обычная, для retina и крупная для предпросмотра
+var DefaultRenditions = []Rendition{
+	{Name: "small", Size: 128},
+	{Name: "medium", Size: 256},
+	{Name: "large", Size: 512},
+}
+
+// Размер миниатюры из thumb_path
+const thumbSize = 100
+
+// Предел размера миниатюры: крупнее — это уже не миниатюра
+const maxRenditionSize = 4096
+
+var renditionNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// ParseRenditions читает список миниатюр вида "small=128,medium=256,square=128:crop";
+// пустая строка — DefaultRenditions
+func ParseRenditions(spec string) ([]Rendition, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultRenditions, nil
+	}
+	var renditions []Rendition
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, size, ok := strings.Cut(item, "=")
+		if !ok || !renditionNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid rendition %q: expected name=size or name=size:crop", item)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate rendition %q", name)
+		}
+		seen[name] = true
+
+		r := Rendition{Name: name}
+		if s, found := strings.CutSuffix(size, ":crop"); found {
+			size, r.Crop = s, true
+		}
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 || n > maxRenditionSize {
+			return nil, fmt.Errorf("invalid rendition size %q: expected 1..%d", size, maxRenditionSize)
+		}
+		r.Size = n
+		renditions = append(renditions, r)
+	}
+	if len(renditions) == 0 {
+		return nil, fmt.Errorf("no renditions in %q", spec)
+	}
+	return renditions, nil
+}
+
+// storedRendition — миниатюра, записанная в базу при прошлой загрузке
+type storedRendition struct {
+	Rendition
+	Path   string
+	Width  int
+	Height int
+	File   fileState
+}
+
+// renditionName возвращает имя файла миниатюры name для изображения fileName.
+// Суффикс _thumb нужен, чтобы сканирование не приняло миниатюру за изображение.
+func renditionName(fileName, name string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "_thumb_" + name + thumbExt(fileName)
+}
+
+// renditionPath возвращает путь миниатюры name в том виде, в котором он хранится в базе
+func (img catalogImage) renditionPath(name string) string {
+	return filepath.Join(filepath.Dir(img.FilePath), renditionName(filepath.Base(img.FilePath), name))
+}
+
+// renditionFilePath возвращает путь к файлу миниатюры name внутри baseFolder
+func (img catalogImage) renditionFilePath(baseFolder, name string) string {
+	return filepath.Join(baseFolder, img.Family, img.Group, img.Subgroup, renditionName(filepath.Base(img.FilePath), name))
+}
+
+// render уменьшает img до миниатюры: вписывает в квадрат Size с сохранением пропорций
+// или, при Crop, заполняет его и обрезает лишнее по центру
+func (r Rendition) render(img image.Image) image.Image {
+	size := uint(r.Size)
+	if !r.Crop {
+		return resize.Thumbnail(size, size, img, resize.Lanczos3)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= bounds.Dy() && bounds.Dx() > r.Size {
+		img = resize.Resize(size, 0, img, resize.Lanczos3)
+	} else if bounds.Dy() < bounds.Dx() && bounds.Dy() > r.Size {
+		img = resize.Resize(0, size, img, resize.Lanczos3)
+	}
+
+	bounds = img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x, y, x+side, y+side)
+
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(square)
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(out, out.Bounds(), img, square.Min, draw.Src)
+	return out
+}
@@ -0,0 +1,138 @@
+package scripts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Имя файла с метаданными по умолчанию для всей подгруппы
+const subgroupMetaName = "_meta"
+
+var sidecarExts = []string{".json", ".yaml", ".yml"}
+
+// Sidecar описывает метаданные изображения, которые художник кладёт рядом с файлом
+type Sidecar struct {
+	Tags        []string `json:"tags" yaml:"tags"`
+	Title       string   `json:"title" yaml:"title"`
+	Description string   `json:"description" yaml:"description"`
+	Author      string   `json:"author" yaml:"author"`
+	License     string   `json:"license" yaml:"license"`
+}
+
+// SidecarError сообщает о некорректном sidecar-файле
+type SidecarError struct {
+	Path string
+	Err  error
+}
+
+func (e *SidecarError) Error() string {
+	return fmt.Sprintf("invalid sidecar %s: %v", e.Path, e.Err)
+}
+
+func (e *SidecarError) Unwrap() error {
+	return e.Err
+}
+
+func isSidecarFile(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, sidecarExt := range sidecarExts {
+		if ext == sidecarExt {
+			return true
+		}
+	}
+	return false
+}
+
+// findSidecar ищет в папке файл base.json / base.yaml / base.yml.
+// Возвращает пустую строку, если sidecar отсутствует.
+func findSidecar(dir, base string) string {
+	for _, ext := range sidecarExts {
+		path := filepath.Join(dir, base+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadSidecar читает и валидирует sidecar-файл. Неизвестные поля считаются ошибкой,
+// чтобы опечатки вроде "tag:" не терялись молча.
+func loadSidecar(path string) (*Sidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &SidecarError{Path: path, Err: err}
+	}
+
+	var sc Sidecar
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&sc)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&sc)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, &SidecarError{Path: path, Err: err}
+	}
+
+	sc.Tags = normalizeTags(sc.Tags)
+	sc.Title = strings.TrimSpace(sc.Title)
+	sc.Description = strings.TrimSpace(sc.Description)
+	sc.Author = strings.TrimSpace(sc.Author)
+	sc.License = strings.TrimSpace(sc.License)
+
+	return &sc, nil
+}
+
+// normalizeTags приводит теги к нижнему регистру и убирает пустые и повторяющиеся
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// mergeSidecars накладывает метаданные изображения поверх метаданных подгруппы.
+// Теги объединяются, остальные поля изображения имеют приоритет.
+func mergeSidecars(subgroup, image *Sidecar) Sidecar {
+	var merged Sidecar
+	if subgroup != nil {
+		merged = *subgroup
+		merged.Tags = append([]string(nil), subgroup.Tags...)
+	}
+	if image == nil {
+		return merged
+	}
+
+	merged.Tags = normalizeTags(append(merged.Tags, image.Tags...))
+	if image.Title != "" {
+		merged.Title = image.Title
+	}
+	if image.Description != "" {
+		merged.Description = image.Description
+	}
+	if image.Author != "" {
+		merged.Author = image.Author
+	}
+	if image.License != "" {
+		merged.License = image.License
+	}
+	return merged
+}
@@ -0,0 +1,41 @@
+package scripts
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// rasterizeSVG рисует SVG на прозрачном фоне так, что длинная сторона viewBox (а без него —
+// width/height) занимает size пикселей. Неподдерживаемые элементы пропускаются.
+func rasterizeSVG(r io.Reader, size int) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(r, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, err
+	}
+	viewW, viewH := icon.ViewBox.W, icon.ViewBox.H
+	if viewW <= 0 || viewH <= 0 {
+		return nil, fmt.Errorf("svg has no viewBox or size")
+	}
+
+	scale := float64(size) / viewW
+	if viewH > viewW {
+		scale = float64(size) / viewH
+	}
+	width, height := int(viewW*scale+0.5), int(viewH*scale+0.5)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return img, nil
+}
@@ -0,0 +1,204 @@
+package scripts
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// thumbnailOutput — файл миниатюры, который нужно создать
+type thumbnailOutput struct {
+	dst       string
+	rendition Rendition
+}
+
+// thumbnailJob — миниатюры, которые нужно создать для изображения key за одно декодирование
+type thumbnailJob struct {
+	key     string
+	src     string
+	outputs []thumbnailOutput
+}
+
+// staleThumbnails возвращает задания для изображений, у которых на диске нет миниатюры из thumb_path
+// или одной из renditions, файл изображения заменён с прошлой загрузки или миниатюра создана с другими
+// настройками. Изображения из skip пропускаются.
+func staleThumbnails(baseFolder string, disk *catalog, renditions []Rendition, skip map[string]*FileError) []thumbnailJob {
+	var jobs []thumbnailJob
+	for key, img := range disk.Images {
+		if skip[key] != nil {
+			continue
+		}
+		src := img.sourcePath(baseFolder)
+		job := thumbnailJob{key: key, src: src}
+
+		dst := img.thumbFilePath(baseFolder)
+		if img.SourceChanged || !fileExists(dst) || len(img.Renditions) == 0 && squashedThumbnail(src, dst) {
+			job.outputs = append(job.outputs, thumbnailOutput{dst: dst, rendition: Rendition{Name: "thumb", Size: thumbSize}})
+		}
+		for _, r := range renditions {
+			dst := img.renditionFilePath(baseFolder, r.Name)
+			stored, ok := img.Renditions[r.Name]
+			if img.SourceChanged || !ok || stored.Rendition != r || !fileExists(dst) {
+				job.outputs = append(job.outputs, thumbnailOutput{dst: dst, rendition: r})
+			}
+		}
+
+		if len(job.outputs) > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].key < jobs[j].key })
+	return jobs
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
+
+// squashedThumbnail сообщает, что миниатюра dst создана до сохранения пропорций: она квадратная
+// thumbSize x thumbSize, а изображение src — нет. Читаются только заголовки файлов.
+func squashedThumbnail(src, dst string) bool {
+	thumb, err := decodeConfig(dst)
+	if err != nil || thumb.Width != thumbSize || thumb.Height != thumbSize {
+		return false
+	}
+	source, err := decodeConfig(src)
+	return err == nil && source.Width != source.Height
+}
+
+func decodeConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	return cfg, err
+}
+
+// generateThumbnails создаёт миниатюры в workers горутинах и возвращает число созданных файлов
+// и ошибки по ключу изображения. progress вызывается после каждого изображения. При отмене ctx новые задания не начинаются,
+// а начатые не оставляют недописанных файлов; возвращается ctx.Err().
+func generateThumbnails(ctx context.Context, jobs []thumbnailJob, workers int, progress func(done, total int)) (int, map[string]error, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		errs    = make(map[string]error)
+		done    int
+		created int
+		wg      sync.WaitGroup
+	)
+	queue := make(chan thumbnailJob)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				n, err := renderThumbnails(ctx, job.src, job.outputs)
+
+				mu.Lock()
+				if err != nil && ctx.Err() == nil {
+					errs[job.key] = err
+				}
+				created += n
+				done++
+				if progress != nil {
+					progress(done, len(jobs))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return created, errs, ctx.Err()
+}
+
+// renderThumbnails декодирует (SVG — растеризует) изображение один раз и создаёт из него все outputs. Каждый файл пишется
+// во временный и переименовывается, поэтому при ошибке или отмене ctx на диске не остаётся
+// недописанных миниатюр. Возвращает число созданных файлов.
+func renderThumbnails(ctx context.Context, inputPath string, outputs []thumbnailOutput) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var img image.Image
+	if strings.EqualFold(filepath.Ext(inputPath), ".svg") {
+		// Растеризуем сразу в размере самой крупной миниатюры, остальные уменьшаются из неё
+		size := 0
+		for _, out := range outputs {
+			if out.rendition.Size > size {
+				size = out.rendition.Size
+			}
+		}
+		if img, err = rasterizeSVG(file, size); err != nil {
+			return 0, err
+		}
+	} else {
+		// У анимированного GIF берётся первый кадр
+		if img, _, err = image.Decode(file); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, out := range outputs {
+		if err := writeThumbnail(ctx, out.rendition.render(img), out.dst); err != nil {
+			return i, err
+		}
+	}
+	return len(outputs), nil
+}
+
+// writeThumbnail сохраняет m в outputPath в формате по расширению файла
+func writeThumbnail(ctx context.Context, m image.Image, outputPath string) error {
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	out, err := os.CreateTemp(filepath.Dir(outputPath), ".thumb-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if ext == ".jpg" || ext == ".jpeg" {
+		err = jpeg.Encode(out, m, nil)
+	} else {
+		err = png.Encode(out, m)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), outputPath)
+}
@@ -0,0 +1,252 @@
+package scripts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidUpload — загрузка отклонена: некорректное имя семейства, группы или подгруппы
+// либо файл не удалось распознать как изображение
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// Имена семейств, групп и подгрупп: из них собираются имена файлов Family_Group_Subgroup_NN
+var taxonomyNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// UploadResult — изображение, добавленное UploadImage
+type UploadResult struct {
+	ImageID  int
+	Name     string
+	Warnings []FileError
+}
+
+// UploadImage добавляет изображение без доступа к папке: сохраняет content в
+// baseFolder/{family}/{group}/{subgroup} под следующим номером Family_Group_Subgroup_NN, создаёт
+// миниатюры и в одной транзакции записывает изображение и недостающую таксономию. fileName нужен
+// только для расширения. При ошибке созданные файлы удаляются, а база не меняется.
+func UploadImage(ctx context.Context, db *sql.DB, baseFolder, family, group, subgroup, fileName string, content io.Reader, renditions []Rendition) (*UploadResult, error) {
+	for _, name := range [][2]string{{"family", family}, {"group", group}, {"subgroup", subgroup}} {
+		if err := validateTaxonomyName(name[0], name[1]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+		}
+	}
+	if renditions == nil {
+		renditions = DefaultRenditions
+	}
+
+	dir := filepath.Join(baseFolder, family, group, subgroup)
+	createdDirs, err := mkdirAll(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Файл сначала пишется во временный: сканирование пропускает скрытые файлы
+	tmp, err := os.CreateTemp(dir, ".upload-*"+strings.ToLower(filepath.Ext(fileName)))
+	if err != nil {
+		removeDirs(createdDirs)
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeDirs(createdDirs)
+		return nil, err
+	}
+
+	format, err := detectFormat(tmp.Name())
+	if err != nil {
+		removeDirs(createdDirs)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+
+	result, files, err := insertUpload(ctx, db, baseFolder, family, group, subgroup, tmp.Name(), format, renditions)
+	if err != nil {
+		for _, file := range files {
+			os.Remove(file)
+		}
+		removeDirs(createdDirs)
+		return nil, err
+	}
+	return result, nil
+}
+
+// insertUpload выполняет транзакцию загрузки и возвращает пути созданных файлов, чтобы их можно было
+// удалить при ошибке. Номер выбирается под блокировкой подгруппы, поэтому параллельные загрузки
+// в одну подгруппу не получают одинаковый номер.
+func insertUpload(ctx context.Context, db *sql.DB, baseFolder, family, group, subgroup, tmpPath, format string, renditions []Rendition) (*UploadResult, []string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "upload:"+family+"/"+group+"/"+subgroup); err != nil {
+		return nil, nil, err
+	}
+	err = addTaxonomy(tx, &CatalogDiff{
+		AddedFamilies:  []string{family},
+		AddedGroups:    []string{family + "/" + group},
+		AddedSubgroups: []string{family + "/" + group + "/" + subgroup},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := filepath.Join(baseFolder, family, group, subgroup)
+	name, err := nextImageName(tx, dir, family, group, subgroup)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileName := name + formatExt(format)
+
+	// Link не перезаписывает существующий файл, в отличие от Rename
+	var files []string
+	dst := filepath.Join(dir, fileName)
+	if err := os.Link(tmpPath, dst); err != nil {
+		return nil, nil, err
+	}
+	files = append(files, dst)
+
+	img := catalogImage{
+		Family:    family,
+		Group:     group,
+		Subgroup:  subgroup,
+		Name:      name,
+		FilePath:  filepath.Join("static", "images", family, group, subgroup, fileName),
+		ThumbPath: filepath.Join("static", "images", family, group, subgroup, thumbName(fileName)),
+		Format:    format,
+	}
+	var warnings []FileError
+	var subgroupMeta *Sidecar
+	if metaPath := findSidecar(dir, subgroupMetaName); metaPath != "" {
+		if subgroupMeta, err = loadSidecar(metaPath); err != nil {
+			warnings = append(warnings, FileError{Path: metaPath, Stage: StageSidecar, Err: err.Error(), Warning: true})
+		}
+	}
+	img.Meta = mergeSidecars(subgroupMeta, nil)
+	if img.Source, err = currentState(dst, fileState{}); err != nil {
+		return nil, files, err
+	}
+
+	outputs := []thumbnailOutput{{dst: img.thumbFilePath(baseFolder), rendition: Rendition{Name: "thumb", Size: thumbSize}}}
+	for _, r := range renditions {
+		outputs = append(outputs, thumbnailOutput{dst: img.renditionFilePath(baseFolder, r.Name), rendition: r})
+	}
+	for _, out := range outputs {
+		files = append(files, out.dst)
+	}
+	if _, err := renderThumbnails(ctx, dst, outputs); err != nil {
+		return nil, files, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+
+	report := &IngestReport{}
+	imageID, err := processImage(tx, baseFolder, img, renditions, report)
+	if err != nil {
+		return nil, files, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, files, err
+	}
+	return &UploadResult{ImageID: imageID, Name: name, Warnings: append(warnings, report.Errors...)}, nil, nil
+}
+
+// nextImageName возвращает имя Family_Group_Subgroup_NN со следующим после занятых номером.
+// Занятыми считаются номера изображений в базе и файлов в папке подгруппы; номер дополняется
+// нулями до двух цифр или до ширины самого длинного занятого номера.
+func nextImageName(tx *sql.Tx, dir, family, group, subgroup string) (string, error) {
+	prefix := family + "_" + group + "_" + subgroup + "_"
+
+	var names []string
+	rows, err := tx.Query(`
+		SELECT i.name FROM Images i
+		JOIN Subgroups s ON i.subgroup_id = s.id
+		JOIN Groups g ON s.group_id = g.id
+		JOIN Families f ON g.family_id = f.id
+		WHERE f.name = $1 AND g.name = $2 AND s.name = $3`, family, group, subgroup)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+	}
+
+	last, width := 0, 2
+	for _, name := range names {
+		digits := strings.TrimPrefix(name, prefix)
+		if digits == name {
+			continue
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 {
+			continue
+		}
+		if n > last {
+			last = n
+		}
+		if len(digits) > width {
+			width = len(digits)
+		}
+	}
+	return fmt.Sprintf("%s%0*d", prefix, width, last+1), nil
+}
+
+// formatExt возвращает расширение файла для формата, который вернул detectFormat
+func formatExt(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// mkdirAll создаёт dir с недостающими родителями и возвращает созданные папки, начиная с самой вложенной
+func mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// removeDirs удаляет папки, созданные mkdirAll, если они остались пустыми
+func removeDirs(dirs []string) {
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+}